@@ -5,10 +5,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 type Env struct {
-	userEnvPath  string
+	userEnvPath string
+	// guards the tokens, they are refreshed while the bot runs
+	tokenMu      sync.RWMutex
 	ClientId     string
 	ClientSecret string
 	AccessToken  string
@@ -16,6 +19,42 @@ type Env struct {
 	UserName     string
 	RedirectUrl  string
 	Channels     []string
+	// chat transport: ws (default), irc (tls) or irc-plain
+	Transport string
+	// chat messages are sent through irc (default) or helix
+	ChatBackend string
+	// enable websocket permessage-deflate compression
+	Compression bool
+	// proxy url (http, https or socks5), env proxy variables are used if empty
+	Proxy string
+	// file where the irc session is recorded, empty disables recording
+	RecordPath string
+	// recorded session replayed instead of connecting to twitch
+	ReplayPath string
+	// replay with the original timing instead of as fast as possible
+	ReplayRealtime bool
+	// authorize with the device code flow instead of a browser redirect
+	DeviceAuth bool
+	// oauth scopes requested on authorization, twitch defaults are used if empty
+	Scopes []string
+	// revoke the user tokens and exit
+	Logout bool
+	// eventsub transport: websocket or webhook, disabled if empty
+	EventSub string
+	// eventsub websocket endpoint, the twitch one is used if empty
+	EventSubUrl string
+	// base url the eventsub subscriptions are created on, helix if empty
+	EventSubApiUrl string
+	// public https url twitch sends the webhook notifications to
+	EventSubCallback string
+	// webhook signing secret, 10 to 100 characters
+	EventSubSecret string
+	// address the webhook server listens on
+	EventSubAddr string
+	// json file declaring the channel point rewards, needs EventSub
+	RewardsPath string
+	// chat command groups to register: stream, moderation
+	Commands []string
 }
 
 var env Env
@@ -45,6 +84,58 @@ func GetEnv() *Env {
 	if ok {
 		env.RedirectUrl = v
 	}
+	v, ok = botEnv["TRANSPORT"].(string)
+	if ok {
+		env.Transport = v
+	}
+	v, ok = botEnv["CHAT_BACKEND"].(string)
+	if ok {
+		env.ChatBackend = v
+	}
+	v, ok = botEnv["WS_COMPRESSION"].(string)
+	if ok {
+		env.Compression = v == "true"
+	}
+	v, ok = botEnv["PROXY"].(string)
+	if ok {
+		env.Proxy = v
+	}
+	v, ok = botEnv["EVENTSUB"].(string)
+	if ok {
+		env.EventSub = v
+	}
+	v, ok = botEnv["EVENTSUB_URL"].(string)
+	if ok {
+		env.EventSubUrl = v
+	}
+	v, ok = botEnv["EVENTSUB_API_URL"].(string)
+	if ok {
+		env.EventSubApiUrl = v
+	}
+	v, ok = botEnv["EVENTSUB_CALLBACK"].(string)
+	if ok {
+		env.EventSubCallback = v
+	}
+	v, ok = botEnv["EVENTSUB_SECRET"].(string)
+	if ok {
+		env.EventSubSecret = v
+	}
+	v, ok = botEnv["EVENTSUB_ADDR"].(string)
+	if ok {
+		env.EventSubAddr = v
+	}
+	v, ok = botEnv["REWARDS"].(string)
+	if ok {
+		env.RewardsPath = v
+	}
+	v, ok = botEnv["COMMANDS"].(string)
+	if ok {
+		env.Commands = strings.Fields(v)
+	}
+	v, ok = botEnv["SCOPES"].(string)
+	if ok {
+		env.Scopes = strings.Fields(v)
+	}
 	if userEnvPath == "" {
 		v, ok := botEnv["DEFAULT_USER"].(string)
 		if ok {
@@ -95,6 +186,22 @@ func parseArgs() (string, string) {
 				argError("Missing user env file")
 			}
 			userEnvPath = os.Args[i+1]
+		case "--record":
+			if argLen < i+1 {
+				argError("Missing record file")
+			}
+			env.RecordPath = os.Args[i+1]
+		case "--replay":
+			if argLen < i+1 {
+				argError("Missing replay file")
+			}
+			env.ReplayPath = os.Args[i+1]
+		case "--replay-realtime":
+			env.ReplayRealtime = true
+		case "--device":
+			env.DeviceAuth = true
+		case "--logout":
+			env.Logout = true
 		case "--init":
 			if argLen < i+1 {
 				argError("Please specify the env file path to generate")
@@ -108,6 +215,30 @@ CLIENT_SECRET=
 REDIRECT_URL=
 # Default user - Will be used if --user arg is not provided
 DEFAULT_USER=
+# Chat transport - ws (websocket), irc (tcp with tls) or irc-plain (tcp without tls)
+TRANSPORT=ws
+# Send chat messages through irc or helix - helix reports messages dropped by automod or slow mode
+CHAT_BACKEND=irc
+# Compress websocket messages (permessage-deflate) - true or false
+WS_COMPRESSION=false
+# Proxy url (http://, https:// or socks5://) - HTTPS_PROXY env variable is used if empty
+PROXY=
+# Receive follows, channel point redemptions, stream, hype train and poll events - websocket, webhook or empty to disable
+EVENTSUB=
+# EventSub websocket url - the twitch one is used if empty, eg. ws://127.0.0.1:8080/ws for the twitch cli mock server
+EVENTSUB_URL=
+# EventSub subscriptions api url - helix is used if empty, eg. http://127.0.0.1:8080 for the twitch cli mock server
+EVENTSUB_API_URL=
+# EventSub webhook public https callback url, signing secret (10 to 100 characters) and local listen address
+EVENTSUB_CALLBACK=
+EVENTSUB_SECRET=
+EVENTSUB_ADDR=:8080
+# Channel point rewards json file - synced at startup, needs EVENTSUB
+REWARDS=
+# Chat command groups separated by spaces - stream (!uptime, !title, !game), moderation (!timeout, !ban, ...) or empty to disable
+COMMANDS=
+# OAuth scopes separated by spaces - scopes needed by the enabled features are always added
+SCOPES=
 `
 			f, err := filepath.Abs(os.Args[i+1])
 			if err != nil {
@@ -196,7 +327,30 @@ func argError(error string) {
 	os.Exit(1)
 }
 
+// current user tokens, safe for concurrent use
+func (e *Env) Tokens() (string, string) {
+	e.tokenMu.RLock()
+	defer e.tokenMu.RUnlock()
+	return e.AccessToken, e.RefreshToken
+}
+
+// replaces the user tokens and writes them to the user env file
+func (e *Env) SetTokens(accessToken string, refreshToken string) {
+	e.tokenMu.Lock()
+	defer e.tokenMu.Unlock()
+	e.AccessToken = accessToken
+	e.RefreshToken = refreshToken
+	e.writeTokens()
+}
+
 func (e *Env) UpdateTokens() {
+	e.tokenMu.Lock()
+	defer e.tokenMu.Unlock()
+	e.writeTokens()
+}
+
+// rewrites the token lines of the user env file, tokenMu must be held
+func (e *Env) writeTokens() {
 	if e.userEnvPath == "" {
 		println("User env file path is not defined.")
 		return
@@ -1,12 +1,18 @@
 package bot
 
-import "github.com/tcode92/twitch-bot/ws"
+import "sync"
 
 type Bot struct {
 	OnMessage     func(message ChatMsg)
 	OnChannelJoin func(channel JoinChan)
-	env           *Env
-	client        *ws.Client
+	// carries the irc lines, selected from the env on Connect if nil
+	Transport Transport
+	// delivers sent messages, irc through the Transport if nil
+	Sender ChatSender
+	env    *Env
+	// handlers still running
+	handlers sync.WaitGroup
+	commands commands
 }
 
 func New(env *Env) *Bot {
@@ -14,6 +20,5 @@ func New(env *Env) *Bot {
 		OnMessage:     func(message ChatMsg) {},
 		OnChannelJoin: func(channel JoinChan) {},
 		env:           env,
-		client:        nil,
 	}
 }
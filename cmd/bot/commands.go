@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+)
+
+// chat messages starting with the prefix are looked up as commands
+const CommandPrefix = "!"
+
+// Command is a chat command like !uptime
+type Command struct {
+	// name without the prefix
+	Name string
+	// only moderators and the channel owner can run it
+	ModOnly bool
+	Handler func(c *CommandContext)
+}
+
+// CommandContext is passed to a command handler
+type CommandContext struct {
+	Bot     *Bot
+	Message ChatMsg
+	// words after the command name
+	Args []string
+}
+
+// answers the command message in its channel
+func (c *CommandContext) Reply(message string) (SendResult, error) {
+	return c.Bot.SendReply(c.Message.Channel, c.Message.Id, message)
+}
+
+// command registry, guarded so commands can be added while connected
+type commands struct {
+	mu     sync.RWMutex
+	byName map[string]Command
+}
+
+// registers a command, a command with the same name is replaced
+func (b *Bot) RegisterCommand(cmd Command) {
+	b.commands.mu.Lock()
+	defer b.commands.mu.Unlock()
+	if b.commands.byName == nil {
+		b.commands.byName = map[string]Command{}
+	}
+	b.commands.byName[strings.ToLower(cmd.Name)] = cmd
+}
+
+// the registered command a message invokes, with its arguments
+func (b *Bot) findCommand(m ChatMsg) (Command, []string, bool) {
+	if !strings.HasPrefix(m.Message, CommandPrefix) {
+		return Command{}, nil, false
+	}
+	fields := strings.Fields(strings.TrimPrefix(m.Message, CommandPrefix))
+	if len(fields) == 0 {
+		return Command{}, nil, false
+	}
+	b.commands.mu.RLock()
+	defer b.commands.mu.RUnlock()
+	cmd, ok := b.commands.byName[strings.ToLower(fields[0])]
+	return cmd, fields[1:], ok
+}
+
+func (b *Bot) runCommand(cmd Command, m ChatMsg, args []string) {
+	if cmd.ModOnly && !m.IsMod {
+		return
+	}
+	cmd.Handler(&CommandContext{Bot: b, Message: m, Args: args})
+}
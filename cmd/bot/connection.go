@@ -5,75 +5,112 @@ import (
 	"regexp"
 	"strings"
 	"time"
-
-	"github.com/tcode92/twitch-bot/ws"
 )
 
 func (b *Bot) Connect() chan interface{} {
-	exitChan := make(chan interface{})
+	// buffered so a late disconnect never blocks
+	exitChan := make(chan interface{}, 1)
+	exit := func() {
+		select {
+		case exitChan <- nil:
+		default:
+		}
+	}
 	go func() {
 		loggedIn := make(chan interface{})
-		client, err := ws.NewClient("wss://irc-ws.chat.twitch.tv:443/")
-		b.client = client
-		client.OnDisconnect = func() {
-			println("Disconnected.")
+		if b.Transport == nil {
+			t, err := newTransport(b.env)
+			if err != nil {
+				println(err.Error())
+				exit()
+				return
+			}
+			b.Transport = t
 		}
-		client.OnTextMessage = func(ircMsg string) {
+		onLine := func(ircMsg string) {
 			m := b.parseIrcMsg(ircMsg)
 			switch v := m.(type) {
 			case LoginError:
 				println(v)
-				exitChan <- nil
+				exit()
 			case ChatMsg:
-				go b.OnMessage(v)
+				b.handle(func() { b.OnMessage(v) })
+				if cmd, args, ok := b.findCommand(v); ok {
+					b.handle(func() { b.runCommand(cmd, v, args) })
+				}
 			case JoinChan:
-				go b.OnChannelJoin(v)
+				b.handle(func() { b.OnChannelJoin(v) })
 			case Ping:
-				go client.SendText("PONG :tmi.twitch.tv")
+				go b.Transport.Send("PONG :tmi.twitch.tv")
 			case Login:
 				println("Login sucessful")
 				loggedIn <- nil
-
 			}
 		}
-		client.OnPong = func() {
-			println("got pong")
-		}
-		if err != nil {
-			println(err.Error())
-			exitChan <- nil
+		onClose := func() {
+			println("Disconnected.")
+			// let the handlers of the last lines finish
+			b.handlers.Wait()
+			exit()
 		}
-		err = client.Connect()
+		err := b.Transport.Connect(onLine, onClose)
 		if err != nil {
 			println(err.Error())
-			exitChan <- nil
+			exit()
+			return
 		}
 
 		println("Connected")
-		client.SendText(fmt.Sprintf("PASS oauth:%s", env.AccessToken))
-		client.SendText(fmt.Sprintf("NICK %s", env.UserName))
+		// tags carry ids, badges and the mod flag of chat messages
+		b.Transport.Send("CAP REQ :twitch.tv/tags")
+		// tokens may have been refreshed since the last connect
+		accessToken, _ := b.env.Tokens()
+		b.Transport.Send(fmt.Sprintf("PASS oauth:%s", accessToken))
+		b.Transport.Send(fmt.Sprintf("NICK %s", b.env.UserName))
 
 		select {
 		case <-loggedIn:
 			// join all channels in env.
-			if len(env.Channels) == 0 {
+			if len(b.env.Channels) == 0 {
 				println("No channels to join.")
-				exitChan <- nil
+				exit()
+				return
 			}
-			for _, c := range env.Channels {
-				client.SendText(fmt.Sprintf("JOIN #%s", c))
+			for _, c := range b.env.Channels {
+				b.Transport.Send(fmt.Sprintf("JOIN #%s", c))
 			}
 		case <-time.After(time.Second * 10):
-			exitChan <- nil
+			exit()
 		}
 	}()
 	return exitChan
 }
 
-func (b *Bot) SendMessage(channel string, message string) {
-	if b.client != nil {
-		b.client.SendText(fmt.Sprintf("PRIVMSG #%s :%s", channel, message))
+// runs a handler in its own goroutine
+func (b *Bot) handle(h func()) {
+	b.handlers.Add(1)
+	go func() {
+		defer b.handlers.Done()
+		h()
+	}()
+}
+
+// closes the transport, the channel returned by Connect is signaled
+func (b *Bot) Close() error {
+	if b.Transport == nil {
+		return nil
 	}
+	return b.Transport.Close()
+}
+
+// sends a chat message through the Sender, irc if not set
+func (b *Bot) SendMessage(channel string, message string) (SendResult, error) {
+	return b.send(OutgoingMessage{Channel: channel, Message: message})
+}
+
+// answers the chat message with parentId
+func (b *Bot) SendReply(channel string, parentId string, message string) (SendResult, error) {
+	return b.send(OutgoingMessage{Channel: channel, Message: message, ReplyParentId: parentId})
 }
 
 type JoinChan string
@@ -85,6 +122,16 @@ type ChatMsg struct {
 	User    string
 	Message string
 	Kappa   []string
+	// message tags, empty if twitch sent none
+	Tags map[string]string
+	// message id
+	Id string
+	// user id of the sender
+	UserId string
+	// user id of the channel owner
+	RoomId string
+	// sender is a moderator or the channel owner
+	IsMod bool
 }
 
 var joinChanRE = regexp.MustCompile(`^:.*#(\w+)$`)
@@ -95,6 +142,15 @@ func (b *Bot) parseIrcMsg(msg string) interface{} {
 	if len(parts) == 0 {
 		return nil
 	}
+	var tags map[string]string
+	if strings.HasPrefix(parts[0], "@") {
+		i := strings.Index(parts[0], " ")
+		if i == -1 {
+			return nil
+		}
+		tags = parseTags(parts[0][1:i])
+		parts[0] = parts[0][i+1:]
+	}
 	if parts[0] == ":tmi.twitch.tv NOTICE * :Login authentication failed" {
 		return LoginError("Login authentication failed")
 	}
@@ -118,7 +174,24 @@ func (b *Bot) parseIrcMsg(msg string) interface{} {
 		m.User = matches[1]
 		m.Channel = matches[2]
 		m.Message = matches[3]
+		m.Tags = tags
+		m.Id = tags["id"]
+		m.UserId = tags["user-id"]
+		m.RoomId = tags["room-id"]
+		m.IsMod = tags["mod"] == "1" || strings.Contains(","+tags["badges"], ",broadcaster/") || strings.EqualFold(m.User, m.Channel)
 		return m
 	}
 	return nil
 }
+
+// parses the irc v3 tags of a line, without the leading @
+func parseTags(raw string) map[string]string {
+	tags := map[string]string{}
+	for _, tag := range strings.Split(raw, ";") {
+		k, v, _ := strings.Cut(tag, "=")
+		tags[k] = tagValueReplacer.Replace(v)
+	}
+	return tags
+}
+
+var tagValueReplacer = strings.NewReplacer(`\:`, ";", `\s`, " ", `\\`, `\`, `\r`, "\r", `\n`, "\n")
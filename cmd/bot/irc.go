@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const twitchIrcTlsAddr = "irc.chat.twitch.tv:6697"
+const twitchIrcAddr = "irc.chat.twitch.tv:6667"
+
+// raw irc over tcp, lines are terminated by CRLF
+type ircTransport struct {
+	addr   string
+	useTls bool
+	conn   net.Conn
+	// serializes line writes
+	mu sync.Mutex
+}
+
+func newIrcTransport(useTls bool) *ircTransport {
+	t := &ircTransport{addr: twitchIrcAddr, useTls: useTls}
+	if useTls {
+		t.addr = twitchIrcTlsAddr
+	}
+	return t
+}
+
+func (t *ircTransport) Connect(onLine func(line string), onClose func()) error {
+	dialer := &net.Dialer{Timeout: time.Second * 10}
+	var conn net.Conn
+	var err error
+	if t.useTls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", t.addr, &tls.Config{})
+	} else {
+		conn, err = dialer.Dial("tcp", t.addr)
+	}
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+	go func() {
+		defer onClose()
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line != "" {
+				onLine(line)
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *ircTransport) Send(line string) error {
+	if t.conn == nil {
+		return errors.New("not connected")
+	}
+	// a line break would inject a second command
+	if strings.ContainsAny(line, "\r\n") {
+		return errors.New("irc line contains a line break")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+func (t *ircTransport) Close() error {
+	if t.conn == nil {
+		return errors.New("not connected")
+	}
+	return t.conn.Close()
+}
@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a recorded line is "<RFC3339 timestamp> <direction> <irc line>"
+const (
+	recordIn  = "<"
+	recordOut = ">"
+)
+
+// Recorder wraps a transport and writes every line with its timestamp to a file
+type Recorder struct {
+	transport Transport
+	f         *os.File
+	mu        sync.Mutex
+}
+
+// opens (or creates) the record file, new lines are appended
+func NewRecorder(t Transport, path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{transport: t, f: f}, nil
+}
+
+func (r *Recorder) Connect(onLine func(line string), onClose func()) error {
+	return r.transport.Connect(func(line string) {
+		r.record(recordIn, line)
+		onLine(line)
+	}, onClose)
+}
+
+func (r *Recorder) Send(line string) error {
+	r.record(recordOut, line)
+	return r.transport.Send(line)
+}
+
+func (r *Recorder) Close() error {
+	err := r.transport.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.f.Close()
+	return err
+}
+
+func (r *Recorder) record(direction string, line string) {
+	// never write the oauth token to disk
+	if strings.HasPrefix(line, "PASS ") {
+		line = "PASS oauth:***"
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := fmt.Fprintf(r.f, "%s %s %s\n", time.Now().UTC().Format(time.RFC3339Nano), direction, line)
+	if err != nil {
+		println("Error recording irc line:", err.Error())
+	}
+}
+
+// Replayer is a transport feeding a recorded session back to the bot
+//
+// only received lines are replayed, lines sent by the bot are passed to OnSend
+type Replayer struct {
+	path string
+	// wait between lines as in the original session, otherwise replay as fast as possible
+	Realtime bool
+	// called with every line the bot sends during the replay
+	OnSend func(line string)
+	done   chan struct{}
+	once   sync.Once
+}
+
+func NewReplayer(path string, realtime bool) *Replayer {
+	return &Replayer{
+		path:     path,
+		Realtime: realtime,
+		done:     make(chan struct{}),
+	}
+}
+
+func (r *Replayer) Connect(onLine func(line string), onClose func()) error {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer f.Close()
+		defer onClose()
+		var last time.Time
+		scanner := bufio.NewScanner(f)
+		// twitch lines with tags can be longer than the default 64KB token
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			ts, direction, line, err := parseRecordLine(scanner.Text())
+			if err != nil {
+				println(err.Error())
+				continue
+			}
+			if direction != recordIn {
+				continue
+			}
+			if r.Realtime && !last.IsZero() {
+				select {
+				case <-time.After(ts.Sub(last)):
+				case <-r.done:
+					return
+				}
+			}
+			last = ts
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+			onLine(line)
+		}
+		if err := scanner.Err(); err != nil {
+			println("Error reading record file:", err.Error())
+		}
+	}()
+	return nil
+}
+
+func (r *Replayer) Send(line string) error {
+	if r.OnSend != nil {
+		r.OnSend(line)
+	}
+	return nil
+}
+
+func (r *Replayer) Close() error {
+	r.once.Do(func() {
+		close(r.done)
+	})
+	return nil
+}
+
+// parse a line written by the Recorder
+func parseRecordLine(l string) (time.Time, string, string, error) {
+	parts := strings.SplitN(l, " ", 3)
+	if len(parts) != 3 {
+		return time.Time{}, "", "", errors.New("invalid record line: " + l)
+	}
+	ts, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", "", fmt.Errorf("invalid record timestamp: %w", err)
+	}
+	if parts[1] != recordIn && parts[1] != recordOut {
+		return time.Time{}, "", "", errors.New("invalid record direction: " + parts[1])
+	}
+	return ts, parts[1], parts[2], nil
+}
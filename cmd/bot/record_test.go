@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorded session with a join, chat messages and commands of a viewer and a moderator
+const testSession = "testdata/session.txt"
+
+// lines the bot sent while replaying
+type sentLines struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (s *sentLines) add(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, line)
+}
+
+// sent PRIVMSG lines, with their tags
+func (s *sentLines) privmsgs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgs := []string{}
+	for _, l := range s.lines {
+		if strings.Contains(l, "PRIVMSG ") {
+			msgs = append(msgs, l)
+		}
+	}
+	return msgs
+}
+
+// replays path through a bot until the session ends
+func replay(t *testing.T, b *Bot, path string) *sentLines {
+	t.Helper()
+	sent := &sentLines{}
+	r := NewReplayer(path, false)
+	r.OnSend = sent.add
+	b.Transport = r
+	select {
+	case <-b.Connect():
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay did not finish")
+	}
+	return sent
+}
+
+func TestReplaySession(t *testing.T) {
+	b := New(&Env{UserName: "testbot", Channels: []string{"streamer"}})
+	var mu sync.Mutex
+	messages := []ChatMsg{}
+	joined := []JoinChan{}
+	b.OnMessage = func(m ChatMsg) {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, m)
+	}
+	b.OnChannelJoin = func(channel JoinChan) {
+		mu.Lock()
+		defer mu.Unlock()
+		joined = append(joined, channel)
+	}
+	b.RegisterCommand(Command{Name: "echo", ModOnly: true, Handler: func(c *CommandContext) {
+		c.Reply(strings.Join(c.Args, " "))
+	}})
+
+	sent := replay(t, b, testSession)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(joined) != 1 || joined[0] != "streamer" {
+		t.Fatalf("joined %v, want [streamer]", joined)
+	}
+	// handlers run concurrently, match the messages by id
+	byId := map[string]ChatMsg{}
+	for _, m := range messages {
+		byId[m.Id] = m
+	}
+	if len(messages) != 4 || len(byId) != 4 {
+		t.Fatalf("%d messages handled, want 4: %+v", len(messages), messages)
+	}
+	m := byId["msg-1"]
+	if m.User != "viewer" || m.Channel != "streamer" || m.Message != "hello Kappa" || m.UserId != "100" || m.RoomId != "200" || m.IsMod {
+		t.Fatalf("unexpected message %+v", m)
+	}
+	if m := byId["msg-2"]; m.User != "moddy" || !m.IsMod {
+		t.Fatalf("unexpected message %+v", m)
+	}
+	// the viewer can't run the mod only command, !uptime is not registered
+	// and recorded replies are not sent again
+	want := []string{"@reply-parent-msg-id=msg-2 PRIVMSG #streamer :hi there"}
+	if got := sent.privmsgs(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChatSender delivers the messages sent with Bot.SendMessage
+type ChatSender interface {
+	SendChatMessage(m OutgoingMessage) (SendResult, error)
+}
+
+type OutgoingMessage struct {
+	Channel string
+	Message string
+	// id of the message answered, empty for a plain message
+	ReplyParentId string
+}
+
+type SendResult struct {
+	MessageId string
+	// false when twitch dropped the message, eg. held by automod or slow mode
+	IsSent      bool
+	DropCode    string
+	DropMessage string
+}
+
+// sends PRIVMSG lines through the bot transport, twitch doesn't report drops over irc
+type ircSender struct {
+	bot *Bot
+}
+
+func (s ircSender) SendChatMessage(m OutgoingMessage) (SendResult, error) {
+	if s.bot.Transport == nil {
+		return SendResult{}, fmt.Errorf("not connected")
+	}
+	line := fmt.Sprintf("PRIVMSG #%s :%s", m.Channel, m.Message)
+	if m.ReplyParentId != "" {
+		line = fmt.Sprintf("@reply-parent-msg-id=%s %s", m.ReplyParentId, line)
+	}
+	if err := s.bot.Transport.Send(line); err != nil {
+		return SendResult{}, err
+	}
+	return SendResult{IsSent: true}, nil
+}
+
+func (b *Bot) sender() ChatSender {
+	if b.Sender != nil {
+		return b.Sender
+	}
+	return ircSender{bot: b}
+}
+
+func (b *Bot) send(m OutgoingMessage) (SendResult, error) {
+	// a line break would end the irc line
+	m.Message = strings.NewReplacer("\r", " ", "\n", " ").Replace(m.Message)
+	res, err := b.sender().SendChatMessage(m)
+	if err != nil {
+		println("Error sending message:", err.Error())
+		return res, err
+	}
+	if !res.IsSent {
+		fmt.Printf("Message to %s dropped: %s %s\n", m.Channel, res.DropCode, res.DropMessage)
+	}
+	return res, nil
+}
@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tcode92/twitch-bot/ws"
+)
+
+// Transport carries raw irc lines between the bot and twitch chat
+type Transport interface {
+	// opens the connection, onLine is called for every received line
+	// and onClose once the connection is gone
+	Connect(onLine func(line string), onClose func()) error
+	// sends a single irc line without the line terminator
+	Send(line string) error
+	Close() error
+}
+
+// builds the transport selected by the env
+func newTransport(env *Env) (Transport, error) {
+	if env.ReplayPath != "" {
+		return NewReplayer(env.ReplayPath, env.ReplayRealtime), nil
+	}
+	var t Transport
+	switch env.Transport {
+	case "", "ws":
+		t = newWsTransport(env)
+	case "irc":
+		t = newIrcTransport(true)
+	case "irc-plain":
+		t = newIrcTransport(false)
+	default:
+		return nil, fmt.Errorf("unknown transport: %s", env.Transport)
+	}
+	if env.RecordPath != "" {
+		return NewRecorder(t, env.RecordPath)
+	}
+	return t, nil
+}
+
+const twitchIrcWsUrl = "wss://irc-ws.chat.twitch.tv:443/"
+
+// irc over websocket, every text message holds one or more lines
+type wsTransport struct {
+	env    *Env
+	client *ws.Client
+}
+
+// dialer for websocket connections to twitch, through the PROXY of the env
+// or the proxy env variables
+func NewWsDialer(env *Env) (*ws.Dialer, error) {
+	d := &ws.Dialer{
+		HandshakeTimeout: time.Second * 10,
+		Proxy:            ws.ProxyFromEnvironment,
+	}
+	if env.Proxy != "" {
+		proxy, err := url.Parse(env.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		d.Proxy = ws.ProxyURL(proxy)
+	}
+	return d, nil
+}
+
+func newWsTransport(env *Env) *wsTransport {
+	return &wsTransport{env: env}
+}
+
+func (t *wsTransport) Connect(onLine func(line string), onClose func()) error {
+	client, err := ws.NewClient(twitchIrcWsUrl)
+	if err != nil {
+		return err
+	}
+	if t.env.Compression {
+		client.Compression = &ws.CompressionOptions{}
+	}
+	client.Dialer, err = NewWsDialer(t.env)
+	if err != nil {
+		return err
+	}
+	client.OnTextMessage = func(message string) {
+		for _, line := range strings.Split(message, "\r\n") {
+			if line != "" {
+				onLine(line)
+			}
+		}
+	}
+	client.OnDisconnect = onClose
+	t.client = client
+	return client.Connect()
+}
+
+func (t *wsTransport) Send(line string) error {
+	if t.client == nil {
+		return errors.New("not connected")
+	}
+	return t.client.SendText(line)
+}
+
+func (t *wsTransport) Close() error {
+	if t.client == nil {
+		return errors.New("not connected")
+	}
+	t.client.Close()
+	return nil
+}
@@ -0,0 +1,32 @@
+// Package commands holds the chat commands built on the twitch api
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tcode92/twitch-bot/cmd/bot"
+	"github.com/tcode92/twitch-bot/cmd/twitch"
+)
+
+// time a command may spend on helix requests
+const commandTimeout = time.Second * 10
+
+// user id of the channel, looked up when the message has no tags
+func roomId(ctx context.Context, c *bot.CommandContext, api *twitch.TwitchApi) (string, error) {
+	if c.Message.RoomId != "" {
+		return c.Message.RoomId, nil
+	}
+	u, err := api.GetUserInfo(ctx, c.Message.Channel)
+	if err != nil {
+		return "", err
+	}
+	return u.Id, nil
+}
+
+// logs the error and tells the user the command failed
+func commandError(c *bot.CommandContext, err error) {
+	println("Command error:", err.Error())
+	c.Reply(fmt.Sprintf("@%s the command failed, try again later", c.Message.User))
+}
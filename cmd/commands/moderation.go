@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tcode92/twitch-bot/cmd/bot"
+	"github.com/tcode92/twitch-bot/cmd/twitch"
+)
+
+// RegisterModerationCommands adds the moderator only commands
+//
+//	!timeout <user> <seconds> [reason]
+//	!ban <user> [reason]
+//	!unban <user>
+//	!slow [seconds|off]
+//	!emoteonly [off]
+func RegisterModerationCommands(b *bot.Bot, api *twitch.TwitchApi) {
+	api.RequireScopes(twitch.ModerationScopes...)
+	b.RegisterCommand(bot.Command{Name: "timeout", ModOnly: true, Handler: func(c *bot.CommandContext) {
+		timeout(c, api)
+	}})
+	b.RegisterCommand(bot.Command{Name: "ban", ModOnly: true, Handler: func(c *bot.CommandContext) {
+		ban(c, api)
+	}})
+	b.RegisterCommand(bot.Command{Name: "unban", ModOnly: true, Handler: func(c *bot.CommandContext) {
+		unban(c, api)
+	}})
+	b.RegisterCommand(bot.Command{Name: "slow", ModOnly: true, Handler: func(c *bot.CommandContext) {
+		slow(c, api)
+	}})
+	b.RegisterCommand(bot.Command{Name: "emoteonly", ModOnly: true, Handler: func(c *bot.CommandContext) {
+		emoteOnly(c, api)
+	}})
+}
+
+func timeout(c *bot.CommandContext, api *twitch.TwitchApi) {
+	if len(c.Args) < 2 {
+		c.Reply("Usage: !timeout <user> <seconds> [reason]")
+		return
+	}
+	seconds, err := strconv.Atoi(c.Args[1])
+	if err != nil || seconds <= 0 {
+		c.Reply("Usage: !timeout <user> <seconds> [reason]")
+		return
+	}
+	banUser(c, api, c.Args[0], seconds, strings.Join(c.Args[2:], " "))
+}
+
+func ban(c *bot.CommandContext, api *twitch.TwitchApi) {
+	if len(c.Args) < 1 {
+		c.Reply("Usage: !ban <user> [reason]")
+		return
+	}
+	banUser(c, api, c.Args[0], 0, strings.Join(c.Args[1:], " "))
+}
+
+// bans permanently when seconds is 0
+func banUser(c *bot.CommandContext, api *twitch.TwitchApi, login string, seconds int, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	broadcasterId, err := roomId(ctx, c, api)
+	if err != nil {
+		commandError(c, err)
+		return
+	}
+	login = strings.TrimPrefix(login, "@")
+	user, err := api.GetUserInfo(ctx, login)
+	if err != nil {
+		commandError(c, err)
+		return
+	}
+	if _, err := api.BanUser(ctx, broadcasterId, twitch.BanRequest{UserId: user.Id, Duration: seconds, Reason: reason}); err != nil {
+		commandError(c, err)
+		return
+	}
+	if seconds > 0 {
+		c.Reply(fmt.Sprintf("%s timed out for %ds", user.DisplayName, seconds))
+	} else {
+		c.Reply(fmt.Sprintf("%s banned", user.DisplayName))
+	}
+}
+
+func unban(c *bot.CommandContext, api *twitch.TwitchApi) {
+	if len(c.Args) < 1 {
+		c.Reply("Usage: !unban <user>")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	broadcasterId, err := roomId(ctx, c, api)
+	if err != nil {
+		commandError(c, err)
+		return
+	}
+	user, err := api.GetUserInfo(ctx, strings.TrimPrefix(c.Args[0], "@"))
+	if err != nil {
+		commandError(c, err)
+		return
+	}
+	if err := api.UnbanUser(ctx, broadcasterId, user.Id); err != nil {
+		commandError(c, err)
+		return
+	}
+	c.Reply(fmt.Sprintf("%s unbanned", user.DisplayName))
+}
+
+func slow(c *bot.CommandContext, api *twitch.TwitchApi) {
+	enabled := true
+	settings := twitch.ChatSettings{SlowMode: &enabled}
+	reply := "Slow mode on"
+	if len(c.Args) > 0 {
+		if c.Args[0] == "off" {
+			enabled = false
+			reply = "Slow mode off"
+		} else {
+			seconds, err := strconv.Atoi(c.Args[0])
+			if err != nil || seconds < 3 || seconds > 120 {
+				c.Reply("Usage: !slow [3-120|off]")
+				return
+			}
+			settings.SlowModeWaitTime = &seconds
+			reply = fmt.Sprintf("Slow mode on, %ds between messages", seconds)
+		}
+	}
+	updateChatSettings(c, api, settings, reply)
+}
+
+func emoteOnly(c *bot.CommandContext, api *twitch.TwitchApi) {
+	enabled := len(c.Args) == 0 || c.Args[0] != "off"
+	reply := "Emote only mode on"
+	if !enabled {
+		reply = "Emote only mode off"
+	}
+	updateChatSettings(c, api, twitch.ChatSettings{EmoteMode: &enabled}, reply)
+}
+
+func updateChatSettings(c *bot.CommandContext, api *twitch.TwitchApi, settings twitch.ChatSettings, reply string) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	broadcasterId, err := roomId(ctx, c, api)
+	if err != nil {
+		commandError(c, err)
+		return
+	}
+	if err := api.UpdateChatSettings(ctx, broadcasterId, settings); err != nil {
+		commandError(c, err)
+		return
+	}
+	c.Reply(reply)
+}
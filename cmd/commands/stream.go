@@ -0,0 +1,127 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tcode92/twitch-bot/cmd/bot"
+	"github.com/tcode92/twitch-bot/cmd/twitch"
+)
+
+// RegisterStreamCommands adds !uptime, !title and !game
+//
+// everyone can read the title and game, moderators can update them
+func RegisterStreamCommands(b *bot.Bot, api *twitch.TwitchApi) {
+	api.RequireScopes(twitch.ChannelScopes...)
+	b.RegisterCommand(bot.Command{Name: "uptime", Handler: func(c *bot.CommandContext) {
+		uptime(c, api)
+	}})
+	b.RegisterCommand(bot.Command{Name: "title", Handler: func(c *bot.CommandContext) {
+		title(c, api)
+	}})
+	b.RegisterCommand(bot.Command{Name: "game", Handler: func(c *bot.CommandContext) {
+		game(c, api)
+	}})
+}
+
+func uptime(c *bot.CommandContext, api *twitch.TwitchApi) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	streams, err := api.GetStreams(ctx, nil, []string{c.Message.Channel})
+	if err != nil {
+		commandError(c, err)
+		return
+	}
+	if len(streams) == 0 {
+		c.Reply(fmt.Sprintf("%s is offline", c.Message.Channel))
+		return
+	}
+	c.Reply(fmt.Sprintf("%s has been live for %s", c.Message.Channel, formatDuration(time.Since(streams[0].StartedAt))))
+}
+
+func title(c *bot.CommandContext, api *twitch.TwitchApi) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	broadcasterId, err := roomId(ctx, c, api)
+	if err != nil {
+		commandError(c, err)
+		return
+	}
+	if len(c.Args) == 0 || !c.Message.IsMod {
+		info, err := channelInfo(ctx, api, broadcasterId)
+		if err != nil {
+			commandError(c, err)
+			return
+		}
+		c.Reply(fmt.Sprintf("Title: %s", info.Title))
+		return
+	}
+	newTitle := strings.Join(c.Args, " ")
+	if err := api.ModifyChannelInformation(ctx, broadcasterId, twitch.ModifyChannelRequest{Title: newTitle}); err != nil {
+		commandError(c, err)
+		return
+	}
+	c.Reply(fmt.Sprintf("Title updated: %s", newTitle))
+}
+
+func game(c *bot.CommandContext, api *twitch.TwitchApi) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	broadcasterId, err := roomId(ctx, c, api)
+	if err != nil {
+		commandError(c, err)
+		return
+	}
+	if len(c.Args) == 0 || !c.Message.IsMod {
+		info, err := channelInfo(ctx, api, broadcasterId)
+		if err != nil {
+			commandError(c, err)
+			return
+		}
+		c.Reply(fmt.Sprintf("Game: %s", info.GameName))
+		return
+	}
+	categories, err := api.SearchCategories(ctx, strings.Join(c.Args, " "))
+	if err != nil {
+		commandError(c, err)
+		return
+	}
+	if len(categories) == 0 {
+		c.Reply(fmt.Sprintf("No game found for %s", strings.Join(c.Args, " ")))
+		return
+	}
+	category := categories[0]
+	if err := api.ModifyChannelInformation(ctx, broadcasterId, twitch.ModifyChannelRequest{GameId: category.Id}); err != nil {
+		commandError(c, err)
+		return
+	}
+	c.Reply(fmt.Sprintf("Game updated: %s", category.Name))
+}
+
+func channelInfo(ctx context.Context, api *twitch.TwitchApi, broadcasterId string) (twitch.ChannelInfo, error) {
+	channels, err := api.GetChannelInformation(ctx, broadcasterId)
+	if err != nil {
+		return twitch.ChannelInfo{}, err
+	}
+	if len(channels) == 0 {
+		return twitch.ChannelInfo{}, fmt.Errorf("channel %s not found", broadcasterId)
+	}
+	return channels[0], nil
+}
+
+// eg. 2h 5m 10s
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	if h > 0 {
+		return fmt.Sprintf("%dh %dm %ds", h, m, s)
+	}
+	if m > 0 {
+		return fmt.Sprintf("%dm %ds", m, s)
+	}
+	return fmt.Sprintf("%ds", s)
+}
@@ -1,13 +1,62 @@
 package twitch
 
-import "github.com/tcode92/twitch-bot/cmd/bot"
+import (
+	"net/http"
+
+	"github.com/tcode92/twitch-bot/cmd/bot"
+)
 
 type TwitchApi struct {
-	env *bot.Env
+	env       *bot.Env
+	helix     *helixClient
+	tokens    *TokenSource
+	appTokens *AppTokenSource
+	scopes    *scopeSet
+	users     *userCache
 }
 
 func New(env *bot.Env) TwitchApi {
+	httpClient := &http.Client{}
+	tokens := newTokenSource(env, httpClient)
+	appTokens := newAppTokenSource(env, httpClient)
 	return TwitchApi{
-		env: env,
+		env:       env,
+		helix:     newHelixClient(env, httpClient, tokens, appTokens),
+		tokens:    tokens,
+		appTokens: appTokens,
+		scopes:    &scopeSet{},
+		users:     newUserCache(userCacheSize, userCacheTtl),
 	}
 }
+
+// overrides the helix base url, eg. to point the api at a mock server
+func (t *TwitchApi) SetBaseUrl(u string) {
+	t.helix.baseUrl = u
+}
+
+// overrides the http client used for helix requests
+func (t *TwitchApi) SetHttpClient(c *http.Client) {
+	t.helix.httpClient = c
+	t.tokens.httpClient = c
+	t.appTokens.httpClient = c
+}
+
+// user token source, refreshes the access token when it expires
+func (t *TwitchApi) Tokens() *TokenSource {
+	return t.tokens
+}
+
+// app token source, for calls that don't act on behalf of the user
+func (t *TwitchApi) AppTokens() *AppTokenSource {
+	return t.appTokens
+}
+
+// current helix rate limit bucket of the user token, eg. for metrics
+func (t *TwitchApi) RateLimit() RateLimit {
+	return t.helix.limiter(userAuth).get()
+}
+
+// current helix rate limit bucket of the app token
+func (t *TwitchApi) AppRateLimit() RateLimit {
+	return t.helix.limiter(appAuth).get()
+}
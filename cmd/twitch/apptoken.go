@@ -0,0 +1,65 @@
+package twitch
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/tcode92/twitch-bot/cmd/bot"
+)
+
+// AppTokenSource hands out an app access token obtained with the client credentials flow
+//
+// the token is cached in memory and requested again when it is about to expire
+// or rejected by twitch
+type AppTokenSource struct {
+	env        *bot.Env
+	httpClient *http.Client
+	mu         sync.Mutex
+	token      string
+	expiry     time.Time
+}
+
+func newAppTokenSource(env *bot.Env, httpClient *http.Client) *AppTokenSource {
+	return &AppTokenSource{env: env, httpClient: httpClient}
+}
+
+// cached app access token, a new one is requested when needed
+func (s *AppTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && (s.expiry.IsZero() || time.Until(s.expiry) > tokenRefreshMargin) {
+		return s.token, nil
+	}
+	if err := s.request(ctx); err != nil {
+		return "", err
+	}
+	return s.token, nil
+}
+
+// requests a new app token unless it already changed from stale
+func (s *AppTokenSource) Refresh(ctx context.Context, stale string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != stale {
+		return nil
+	}
+	return s.request(ctx)
+}
+
+// s.mu must be held
+func (s *AppTokenSource) request(ctx context.Context) error {
+	body := url.Values{}
+	body.Set("client_id", s.env.ClientId)
+	body.Set("client_secret", s.env.ClientSecret)
+	body.Set("grant_type", "client_credentials")
+	var token TokenResponse
+	if err := postToken(ctx, s.httpClient, body, &token); err != nil {
+		return err
+	}
+	s.token = token.AccessToken
+	s.expiry = expiryFromNow(token.Expire)
+	return nil
+}
@@ -2,36 +2,52 @@ package twitch
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
+	"html"
+	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
+// time the user has to authorize the application in the browser
+const authTimeout = time.Minute * 5
+
+const authorizeUrl = "https://id.twitch.tv/oauth2/authorize"
+
 func (t *TwitchApi) AuthorizationCodeGrantFlow() error {
+	redirect, err := url.Parse(t.env.RedirectUrl)
+	if err != nil {
+		return fmt.Errorf("invalid redirect url: %w", err)
+	}
+	// random state bound to this flow, protects the callback from csrf
+	state, err := randomState()
+	if err != nil {
+		return err
+	}
 
 	authReq := url.Values{}
 	authReq.Set("client_id", t.env.ClientId)
 	authReq.Set("redirect_uri", t.env.RedirectUrl)
 	authReq.Set("response_type", "code")
-	authReq.Set("scope", "user:read:chat user:write:chat user:edit user:manage:chat_color user:read:emotes user:write:chat chat:edit chat:read")
-
-	println("Please authorize the application through this link\n")
-	println(fmt.Sprintf("https://id.twitch.tv/oauth2/authorize?%s\n\n", authReq.Encode()))
-
-	codeCh := make(chan string)
-	url, err := url.Parse(t.env.RedirectUrl)
+	authReq.Set("scope", strings.Join(t.Scopes(), " "))
+	authReq.Set("state", state)
+
+	ctx, cancel := context.WithTimeout(context.Background(), authTimeout)
+	defer cancel()
+	code, err := authHttpServer(ctx, redirect, state, func() {
+		println("Please authorize the application through this link\n")
+		println(fmt.Sprintf("%s?%s\n\n", authorizeUrl, authReq.Encode()))
+	})
 	if err != nil {
-		println(err.Error())
-		os.Exit(0)
+		return err
 	}
-	go authHttpServer(codeCh, ":"+strings.Split(url.Host, ":")[1])
-
-	code := <-codeCh
 
 	return t.ExchangeCodeWithToken(code)
 }
@@ -44,105 +60,108 @@ func (t *TwitchApi) ExchangeCodeWithToken(code string) error {
 	body.Set("grant_type", "authorization_code")
 	body.Set("code", code)
 	body.Set("redirect_uri", t.env.RedirectUrl)
-	resp, err := http.Post("https://id.twitch.tv/oauth2/token", "application/x-www-form-urlencoded", strings.NewReader(body.Encode()))
-	if err != nil {
+	if err := postToken(context.Background(), t.helix.httpClient, body, &token); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	// Read the response body
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != 200 {
-		e := tokenError{}
-		json.Unmarshal(respBody, &e)
-		return fmt.Errorf("twitch auth error: %s", e.Message)
-	}
-	json.Unmarshal(respBody, &token)
-	t.env.AccessToken = token.AccessToken
-	t.env.RefreshToken = token.RefreshToken
-	t.env.UpdateTokens()
+	t.tokens.set(token.AccessToken, token.RefreshToken, token.Expire)
 	return nil
 }
 
 func (t *TwitchApi) RefreshAccessToken() error {
-
-	body := url.Values{}
-	body.Set("client_id", t.env.ClientId)
-	body.Set("client_secret", t.env.ClientSecret)
-	body.Set("grant_type", "refresh_token")
-	body.Set("refresh_token", t.env.RefreshToken)
-	resp, err := http.Post("https://id.twitch.tv/oauth2/token", "application/x-www-form-urlencoded", strings.NewReader(body.Encode()))
-	var token RefreshTokenResponse
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	// Read the response body
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != 200 {
-		e := tokenError{}
-		json.Unmarshal(respBody, &e)
-		return fmt.Errorf("twitch auth error: %s", e.Message)
-	}
-
-	json.Unmarshal(respBody, &token)
-	t.env.AccessToken = token.AccessToken
-	t.env.RefreshToken = token.RefreshToken
-	t.env.UpdateTokens()
-	return nil
-
+	accessToken, _ := t.env.Tokens()
+	return t.tokens.Refresh(context.Background(), accessToken)
 }
 
-func (t *TwitchApi) ValidateToken() error {
-
-	client := &http.Client{}
+// result of the authorization callback
+type authResult struct {
+	code string
+	err  error
+}
 
-	req, err := http.NewRequest("GET", "https://id.twitch.tv/oauth2/validate", nil)
-	if err != nil {
-		return err
+// serves the redirect url until a callback with the expected state is received,
+// ready is called once the server listens
+func authHttpServer(ctx context.Context, redirect *url.URL, state string, ready func()) (string, error) {
+	port := redirect.Port()
+	if port == "" {
+		port = "80"
+		if redirect.Scheme == "https" {
+			port = "443"
+		}
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("OAuth %s", t.env.AccessToken))
-
-	resp, err := client.Do(req)
+	l, err := net.Listen("tcp", net.JoinHostPort(redirect.Hostname(), port))
 	if err != nil {
-		return err
+		return "", fmt.Errorf("can't listen for the authorization callback: %w", err)
 	}
-	defer resp.Body.Close()
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	path := redirect.Path
+	if path == "" {
+		path = "/"
 	}
-	if resp.StatusCode == 200 {
-		return nil
-	} else {
-		m := tokenError{}
-		err = json.Unmarshal(b, &m)
-		if err != nil {
-			return err
+
+	resultCh := make(chan authResult, 1)
+	var mu sync.Mutex
+	done := false
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		// anything else hitting the path, eg. favicon on "/", is ignored
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(state)) != 1 {
+			// not our flow, keep waiting for the real callback
+			authPage(w, http.StatusBadRequest, "Authorization failed", "Invalid state parameter.")
+			return
+		}
+		// the state is single use
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			authPage(w, http.StatusBadRequest, "Authorization failed", "Authorization already completed.")
+			return
 		}
-		return errors.New(m.Message)
+		done = true
+		var res authResult
+		if e := q.Get("error"); e != "" {
+			res.err = fmt.Errorf("authorization denied: %s: %s", e, q.Get("error_description"))
+			authPage(w, http.StatusOK, "Authorization failed", q.Get("error_description"))
+		} else if code := q.Get("code"); code == "" {
+			res.err = errors.New("authorization callback without code")
+			authPage(w, http.StatusBadRequest, "Authorization failed", "Missing authorization code.")
+		} else {
+			res.code = code
+			authPage(w, http.StatusOK, "Authorization complete", "You can close this window and return to the bot.")
+		}
+		resultCh <- res
+	})
+	s := &http.Server{Handler: mux}
+	go s.Serve(l)
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		s.Shutdown(shutdownCtx)
+	}()
+	ready()
+
+	select {
+	case res := <-resultCh:
+		return res.code, res.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("authorization not completed: %w", ctx.Err())
 	}
 }
 
-func authHttpServer(codeCh chan string, addr string) {
-	ctx := context.Background()
-	s := &http.Server{
-		Addr: addr,
+func authPage(w http.ResponseWriter, status int, title string, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<!DOCTYPE html><html><head><title>%[1]s</title></head><body><h1>%[1]s</h1><p>%[2]s</p></body></html>",
+		html.EscapeString(title), html.EscapeString(message))
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		code := r.URL.Query().Get("code")
-		w.WriteHeader(200)
-		if code == "" {
-			println("Invalid code response.")
-			os.Exit(1)
-		}
-		codeCh <- code
-		s.Shutdown(ctx)
-	})
-	s.ListenAndServe()
+	return hex.EncodeToString(b), nil
 }
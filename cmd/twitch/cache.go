@@ -0,0 +1,87 @@
+package twitch
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+const userCacheSize = 1000
+const userCacheTtl = time.Minute * 10
+
+// lru cache of users with a ttl, looked up by id or login
+type userCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	lru     *list.List
+	byId    map[string]*list.Element
+	byLogin map[string]*list.Element
+}
+
+type userCacheEntry struct {
+	user   UserInfo
+	expiry time.Time
+}
+
+func newUserCache(size int, ttl time.Duration) *userCache {
+	return &userCache{
+		size:    size,
+		ttl:     ttl,
+		lru:     list.New(),
+		byId:    map[string]*list.Element{},
+		byLogin: map[string]*list.Element{},
+	}
+}
+
+func (c *userCache) getById(id string) (UserInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(c.byId[id])
+}
+
+func (c *userCache) getByLogin(login string) (UserInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(c.byLogin[strings.ToLower(login)])
+}
+
+// c.mu must be held
+func (c *userCache) get(e *list.Element) (UserInfo, bool) {
+	if e == nil {
+		return UserInfo{}, false
+	}
+	entry := e.Value.(*userCacheEntry)
+	if time.Now().After(entry.expiry) {
+		c.remove(e)
+		return UserInfo{}, false
+	}
+	c.lru.MoveToFront(e)
+	return entry.user, true
+}
+
+func (c *userCache) add(u UserInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// a renamed user leaves its old login behind
+	if e := c.byId[u.Id]; e != nil {
+		c.remove(e)
+	}
+	if e := c.byLogin[strings.ToLower(u.Login)]; e != nil {
+		c.remove(e)
+	}
+	e := c.lru.PushFront(&userCacheEntry{user: u, expiry: time.Now().Add(c.ttl)})
+	c.byId[u.Id] = e
+	c.byLogin[strings.ToLower(u.Login)] = e
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// c.mu must be held
+func (c *userCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*userCacheEntry)
+	delete(c.byId, entry.user.Id)
+	delete(c.byLogin, strings.ToLower(entry.user.Login))
+}
@@ -0,0 +1,68 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tcode92/twitch-bot/cmd/bot"
+)
+
+// needs a user token with user:write:chat, the sender is the token user
+func (t *TwitchApi) SendChatMessage(ctx context.Context, r SendChatMessageRequest) (SentChatMessage, error) {
+	res, err := helixPost[SentChatMessage](ctx, t.helix, userAuth, "/chat/messages", nil, r)
+	if err != nil {
+		return SentChatMessage{}, err
+	}
+	if len(res.Data) == 0 {
+		return SentChatMessage{}, errors.New("empty send chat message response")
+	}
+	return res.Data[0], nil
+}
+
+// time to resolve the users and send a message
+const chatSendTimeout = time.Second * 10
+
+// sends bot messages through helix, channels are resolved to broadcaster ids
+type helixChatSender struct {
+	api *TwitchApi
+}
+
+// bot.ChatSender sending with the Send Chat Message endpoint
+func (t *TwitchApi) ChatSender() bot.ChatSender {
+	return &helixChatSender{api: t}
+}
+
+func (s *helixChatSender) SendChatMessage(m bot.OutgoingMessage) (bot.SendResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), chatSendTimeout)
+	defer cancel()
+	users, err := s.api.GetUsers(ctx, nil, []string{m.Channel, s.api.env.UserName})
+	if err != nil {
+		return bot.SendResult{}, err
+	}
+	var broadcasterId, senderId string
+	for _, u := range users {
+		if strings.EqualFold(u.Login, m.Channel) {
+			broadcasterId = u.Id
+		}
+		if strings.EqualFold(u.Login, s.api.env.UserName) {
+			senderId = u.Id
+		}
+	}
+	sent, err := s.api.SendChatMessage(ctx, SendChatMessageRequest{
+		BroadcasterId:        broadcasterId,
+		SenderId:             senderId,
+		Message:              m.Message,
+		ReplyParentMessageId: m.ReplyParentId,
+	})
+	if err != nil {
+		return bot.SendResult{}, err
+	}
+	res := bot.SendResult{MessageId: sent.MessageId, IsSent: sent.IsSent}
+	if sent.DropReason != nil {
+		res.DropCode = sent.DropReason.Code
+		res.DropMessage = sent.DropReason.Message
+	}
+	return res, nil
+}
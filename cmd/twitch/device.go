@@ -0,0 +1,72 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const deviceUrl = "https://id.twitch.tv/oauth2/device"
+
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DeviceCodeGrantFlow authorizes the application without a browser on this machine
+//
+// the user opens the printed verification uri on any device and enters the code,
+// meanwhile the token endpoint is polled until the authorization completes
+func (t *TwitchApi) DeviceCodeGrantFlow() error {
+	ctx := context.Background()
+	scopes := strings.Join(t.Scopes(), " ")
+	body := url.Values{}
+	body.Set("client_id", t.env.ClientId)
+	body.Set("scopes", scopes)
+	var device DeviceCodeResponse
+	if err := postForm(ctx, t.helix.httpClient, deviceUrl, body, &device); err != nil {
+		return err
+	}
+
+	println("Please authorize the application on any device through this link\n")
+	println(device.VerificationUri)
+	println(fmt.Sprintf("\nand enter the code: %s\n\n", device.UserCode))
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(device.Expire)*time.Second)
+	defer cancel()
+	interval := time.Duration(device.Interval) * time.Second
+	if interval <= 0 {
+		interval = time.Second * 5
+	}
+
+	body = url.Values{}
+	body.Set("client_id", t.env.ClientId)
+	if t.env.ClientSecret != "" {
+		body.Set("client_secret", t.env.ClientSecret)
+	}
+	body.Set("scopes", scopes)
+	body.Set("device_code", device.DeviceCode)
+	body.Set("grant_type", deviceGrantType)
+	for {
+		if err := sleep(ctx, interval); err != nil {
+			return fmt.Errorf("device authorization not completed: %w", err)
+		}
+		var token TokenResponse
+		err := postToken(ctx, t.helix.httpClient, body, &token)
+		if err == nil {
+			t.tokens.set(token.AccessToken, token.RefreshToken, token.Expire)
+			return nil
+		}
+		var e *tokenError
+		if !errors.As(err, &e) {
+			return err
+		}
+		switch e.Message {
+		case "authorization_pending":
+		case "slow_down":
+			interval += time.Second * 5
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package twitch
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// eventsub subscription types with a typed event
+const (
+	FollowType            = "channel.follow"
+	RedemptionType        = "channel.channel_points_custom_reward_redemption.add"
+	StreamOnlineType      = "stream.online"
+	StreamOfflineType     = "stream.offline"
+	HypeTrainBeginType    = "channel.hype_train.begin"
+	HypeTrainProgressType = "channel.hype_train.progress"
+	HypeTrainEndType      = "channel.hype_train.end"
+	PollBeginType         = "channel.poll.begin"
+	PollProgressType      = "channel.poll.progress"
+	PollEndType           = "channel.poll.end"
+)
+
+// scopes needed to subscribe to the typed events of the broadcaster
+var EventSubScopes = []string{"moderator:read:followers", "channel:read:redemptions", "channel:read:hype_train", "channel:read:polls"}
+
+type FollowEvent struct {
+	UserId               string    `json:"user_id"`
+	UserLogin            string    `json:"user_login"`
+	UserName             string    `json:"user_name"`
+	BroadcasterUserId    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	FollowedAt           time.Time `json:"followed_at"`
+}
+
+type RedemptionEvent struct {
+	Id                   string           `json:"id"`
+	BroadcasterUserId    string           `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string           `json:"broadcaster_user_login"`
+	BroadcasterUserName  string           `json:"broadcaster_user_name"`
+	UserId               string           `json:"user_id"`
+	UserLogin            string           `json:"user_login"`
+	UserName             string           `json:"user_name"`
+	UserInput            string           `json:"user_input"`
+	Status               string           `json:"status"`
+	Reward               RedemptionReward `json:"reward"`
+	RedeemedAt           time.Time        `json:"redeemed_at"`
+}
+
+type RedemptionReward struct {
+	Id     string `json:"id"`
+	Title  string `json:"title"`
+	Cost   int    `json:"cost"`
+	Prompt string `json:"prompt"`
+}
+
+type StreamOnlineEvent struct {
+	Id                   string    `json:"id"`
+	BroadcasterUserId    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	Type                 string    `json:"type"`
+	StartedAt            time.Time `json:"started_at"`
+}
+
+type StreamOfflineEvent struct {
+	BroadcasterUserId    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+}
+
+// begin, progress and end of a hype train share this event
+type HypeTrainEvent struct {
+	// subscription type, eg. HypeTrainEndType
+	Type                 string     `json:"-"`
+	Id                   string     `json:"id"`
+	BroadcasterUserId    string     `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string     `json:"broadcaster_user_login"`
+	BroadcasterUserName  string     `json:"broadcaster_user_name"`
+	Level                int        `json:"level"`
+	Total                int        `json:"total"`
+	Progress             int        `json:"progress"`
+	Goal                 int        `json:"goal"`
+	StartedAt            time.Time  `json:"started_at"`
+	ExpiresAt            *time.Time `json:"expires_at"`
+	EndedAt              *time.Time `json:"ended_at"`
+}
+
+// begin, progress and end of a poll share this event
+type PollEvent struct {
+	// subscription type, eg. PollEndType
+	Type                 string       `json:"-"`
+	Id                   string       `json:"id"`
+	BroadcasterUserId    string       `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string       `json:"broadcaster_user_login"`
+	BroadcasterUserName  string       `json:"broadcaster_user_name"`
+	Title                string       `json:"title"`
+	Choices              []PollChoice `json:"choices"`
+	// set on end: completed, archived or terminated
+	Status    string     `json:"status"`
+	StartedAt time.Time  `json:"started_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+}
+
+type PollChoice struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+	Votes int    `json:"votes"`
+}
+
+// event of a subscription type without a typed event
+type UnknownEvent struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+// decodes the event of a notification into one of the *Event types
+func decodeEvent(subscriptionType string, raw json.RawMessage) (any, error) {
+	switch subscriptionType {
+	case FollowType:
+		return decodeAs[FollowEvent](raw)
+	case RedemptionType:
+		return decodeAs[RedemptionEvent](raw)
+	case StreamOnlineType:
+		return decodeAs[StreamOnlineEvent](raw)
+	case StreamOfflineType:
+		return decodeAs[StreamOfflineEvent](raw)
+	case HypeTrainBeginType, HypeTrainProgressType, HypeTrainEndType:
+		e, err := decodeAs[HypeTrainEvent](raw)
+		e.Type = subscriptionType
+		return e, err
+	case PollBeginType, PollProgressType, PollEndType:
+		e, err := decodeAs[PollEvent](raw)
+		e.Type = subscriptionType
+		return e, err
+	}
+	return UnknownEvent{Type: subscriptionType, Raw: raw}, nil
+}
+
+func decodeAs[T any](raw json.RawMessage) (T, error) {
+	var e T
+	err := json.Unmarshal(raw, &e)
+	return e, err
+}
+
+// subscriptions to the typed events of a broadcaster, moderatorId is the
+// token user, needed by follows
+func BroadcasterSubscriptions(broadcasterId string, moderatorId string) []SubscriptionRequest {
+	condition := map[string]string{"broadcaster_user_id": broadcasterId}
+	subs := []SubscriptionRequest{
+		{Type: FollowType, Version: "2", Condition: map[string]string{"broadcaster_user_id": broadcasterId, "moderator_user_id": moderatorId}},
+	}
+	for _, t := range []string{RedemptionType, StreamOnlineType, StreamOfflineType, HypeTrainBeginType, HypeTrainProgressType, HypeTrainEndType, PollBeginType, PollProgressType, PollEndType} {
+		subs = append(subs, SubscriptionRequest{Type: t, Version: "1", Condition: condition})
+	}
+	return subs
+}
@@ -0,0 +1,359 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tcode92/twitch-bot/cmd/bot"
+	"github.com/tcode92/twitch-bot/ws"
+)
+
+const eventSubUrl = "wss://eventsub.wss.twitch.tv/ws"
+
+// time to wait for the welcome message after connecting
+const eventSubWelcomeTimeout = time.Second * 10
+
+// notifications with the same message id within this window are duplicates
+const eventSubDedupWindow = time.Minute * 10
+
+// EventSub receives eventsub notifications over a websocket session
+//
+// the session is reconnected when twitch asks for it or the keepalive times
+// out, subscriptions are created again when a new session starts
+type EventSub struct {
+	api *TwitchApi
+	url string
+	// created for every new session
+	Subscriptions []SubscriptionRequest
+	// called with the decoded event of every notification, one of the *Event
+	// types or UnknownEvent
+	OnEvent func(event any)
+	// called when twitch revokes a subscription
+	OnRevocation func(s Subscription)
+
+	mu sync.Mutex
+	// session receiving the notifications
+	current *eventSubConn
+	ctx     context.Context
+	cancel  context.CancelFunc
+	seen    *messageIds
+	// a new session is being started after a lost connection
+	reconnecting bool
+}
+
+type eventSubConn struct {
+	client  *ws.Client
+	welcome chan eventSubSession
+	// keepalive timeout from the welcome message
+	keepalive time.Duration
+	// last message received, guarded by EventSub.mu
+	lastMessage time.Time
+	// twitch asked to move to a new session, guarded by EventSub.mu
+	migrating bool
+}
+
+type eventSubMessage struct {
+	Metadata struct {
+		MessageId        string    `json:"message_id"`
+		MessageType      string    `json:"message_type"`
+		MessageTimestamp time.Time `json:"message_timestamp"`
+		SubscriptionType string    `json:"subscription_type"`
+	} `json:"metadata"`
+	Payload struct {
+		Session      *eventSubSession `json:"session"`
+		Subscription *Subscription    `json:"subscription"`
+		Event        json.RawMessage  `json:"event"`
+	} `json:"payload"`
+}
+
+type eventSubSession struct {
+	Id                      string `json:"id"`
+	Status                  string `json:"status"`
+	KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+	ReconnectUrl            string `json:"reconnect_url"`
+}
+
+// the endpoint is the EVENTSUB_URL of the env, the twitch one if empty
+func (t *TwitchApi) NewEventSub() *EventSub {
+	u := t.env.EventSubUrl
+	if u == "" {
+		u = eventSubUrl
+	}
+	return &EventSub{
+		api:  t,
+		url:  u,
+		seen: newMessageIds(eventSubDedupWindow),
+	}
+}
+
+// opens the session and creates the subscriptions, the session is kept
+// alive until Close or ctx is done
+func (e *EventSub) Connect(ctx context.Context) error {
+	e.mu.Lock()
+	e.ctx, e.cancel = context.WithCancel(ctx)
+	e.mu.Unlock()
+	if err := e.start(); err != nil {
+		e.cancel()
+		return err
+	}
+	go e.watchKeepalive()
+	return nil
+}
+
+func (e *EventSub) Close() {
+	e.mu.Lock()
+	c := e.current
+	e.current = nil
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.mu.Unlock()
+	if c != nil {
+		c.client.Close()
+	}
+}
+
+// opens a new session on the default url and subscribes
+func (e *EventSub) start() error {
+	c, session, err := e.dial(e.url)
+	if err != nil {
+		return err
+	}
+	err = e.api.Subscribe(e.ctx, e.Subscriptions, SubscriptionTransport{Method: "websocket", SessionId: session.Id})
+	if err != nil {
+		c.client.Close()
+		return err
+	}
+	// reconnect cleared the current session before starting
+	e.swap(nil, c)
+	return nil
+}
+
+// connects and waits for the welcome message
+func (e *EventSub) dial(u string) (*eventSubConn, eventSubSession, error) {
+	client, err := ws.NewClient(u)
+	if err != nil {
+		return nil, eventSubSession{}, err
+	}
+	// same proxy as the chat connection
+	client.Dialer, err = bot.NewWsDialer(e.api.env)
+	if err != nil {
+		return nil, eventSubSession{}, err
+	}
+	c := &eventSubConn{client: client, welcome: make(chan eventSubSession, 1)}
+	client.OnTextMessage = func(message string) {
+		e.handleMessage(c, message)
+	}
+	client.OnDisconnect = func() {
+		e.disconnected(c)
+	}
+	if err := client.ConnectContext(e.ctx); err != nil {
+		return nil, eventSubSession{}, err
+	}
+	select {
+	case session := <-c.welcome:
+		c.keepalive = time.Duration(session.KeepaliveTimeoutSeconds) * time.Second
+		return c, session, nil
+	case <-time.After(eventSubWelcomeTimeout):
+		client.Close()
+		return nil, eventSubSession{}, errors.New("eventsub welcome message not received")
+	case <-e.ctx.Done():
+		client.Close()
+		return nil, eventSubSession{}, e.ctx.Err()
+	}
+}
+
+// makes c the session receiving notifications in place of from, which is
+// closed
+//
+// c is dropped when the current session is not from anymore, eg. a reconnect
+// started while c was connecting
+func (e *EventSub) swap(from *eventSubConn, c *eventSubConn) {
+	e.mu.Lock()
+	if e.ctx.Err() != nil || e.current != from {
+		// closed or replaced while connecting
+		e.mu.Unlock()
+		c.client.Close()
+		return
+	}
+	c.lastMessage = time.Now()
+	e.current = c
+	e.mu.Unlock()
+	if from != nil {
+		from.client.Close()
+	}
+}
+
+func (e *EventSub) handleMessage(c *eventSubConn, message string) {
+	var m eventSubMessage
+	if err := json.Unmarshal([]byte(message), &m); err != nil {
+		println("Invalid eventsub message:", err.Error())
+		return
+	}
+	e.mu.Lock()
+	c.lastMessage = time.Now()
+	e.mu.Unlock()
+
+	switch m.Metadata.MessageType {
+	case "session_welcome":
+		if m.Payload.Session != nil {
+			select {
+			case c.welcome <- *m.Payload.Session:
+			default:
+			}
+		}
+	case "session_keepalive":
+	case "session_reconnect":
+		if m.Payload.Session == nil {
+			return
+		}
+		e.mu.Lock()
+		// a lost connection of a migrating session is left to migrate
+		migrate := e.current == c && !c.migrating
+		if migrate {
+			c.migrating = true
+		}
+		e.mu.Unlock()
+		if migrate {
+			go e.migrate(c, m.Payload.Session.ReconnectUrl)
+		}
+	case "notification":
+		// the old and the new session can both deliver an event while migrating
+		if !e.seen.add(m.Metadata.MessageId) {
+			return
+		}
+		event, err := decodeEvent(m.Metadata.SubscriptionType, m.Payload.Event)
+		if err != nil {
+			println("Invalid eventsub event:", err.Error())
+			return
+		}
+		if e.OnEvent != nil {
+			e.OnEvent(event)
+		}
+	case "revocation":
+		if m.Payload.Subscription != nil && e.OnRevocation != nil {
+			e.OnRevocation(*m.Payload.Subscription)
+		}
+	}
+}
+
+// moves from the old session to the one at the reconnect url, subscriptions
+// carry over
+//
+// the old session keeps delivering until the new one is welcomed
+func (e *EventSub) migrate(old *eventSubConn, u string) {
+	c, _, err := e.dial(u)
+	if err == nil {
+		e.swap(old, c)
+		return
+	}
+	println("EventSub reconnect failed:", err.Error())
+	e.mu.Lock()
+	current := e.current == old
+	e.mu.Unlock()
+	if current {
+		e.reconnect()
+	}
+}
+
+func (e *EventSub) disconnected(c *eventSubConn) {
+	e.mu.Lock()
+	// replaced sessions are closed on purpose, a migrating one is replaced or
+	// reconnected by migrate
+	reconnect := e.current == c && !c.migrating
+	e.mu.Unlock()
+	if reconnect {
+		e.reconnect()
+	}
+}
+
+// starts a new session after a lost connection, retrying with backoff
+func (e *EventSub) reconnect() {
+	e.mu.Lock()
+	if e.reconnecting {
+		e.mu.Unlock()
+		return
+	}
+	e.reconnecting = true
+	old := e.current
+	e.current = nil
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.reconnecting = false
+		e.mu.Unlock()
+	}()
+	if old != nil {
+		old.client.Close()
+	}
+	for attempt := 0; e.ctx.Err() == nil; attempt++ {
+		err := e.start()
+		if err == nil {
+			return
+		}
+		println("EventSub reconnect failed:", err.Error())
+		if sleep(e.ctx, backoff(min(attempt, 6))) != nil {
+			return
+		}
+	}
+}
+
+// reconnects when no message arrives within the keepalive timeout
+func (e *EventSub) watchKeepalive() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		e.mu.Lock()
+		c := e.current
+		expired := c != nil && c.keepalive > 0 && time.Since(c.lastMessage) > c.keepalive+time.Second*5
+		e.mu.Unlock()
+		if expired {
+			println("EventSub keepalive timed out")
+			// the disconnect starts a new session
+			c.client.Close()
+		}
+	}
+}
+
+// message ids seen within a window, for dropping duplicate deliveries
+type messageIds struct {
+	mu     sync.Mutex
+	window time.Duration
+	ids    map[string]time.Time
+}
+
+func newMessageIds(window time.Duration) *messageIds {
+	return &messageIds{window: window, ids: map[string]time.Time{}}
+}
+
+// records id, false when it was already seen
+func (m *messageIds) add(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for k, t := range m.ids {
+		if now.Sub(t) > m.window {
+			delete(m.ids, k)
+		}
+	}
+	if _, ok := m.ids[id]; ok {
+		return false
+	}
+	m.ids[id] = now
+	return true
+}
+
+// forgets id so the message is handled when it is delivered again
+func (m *messageIds) remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.ids, id)
+}
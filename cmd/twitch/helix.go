@@ -0,0 +1,271 @@
+package twitch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tcode92/twitch-bot/cmd/bot"
+)
+
+const helixBaseUrl = "https://api.twitch.tv/helix"
+
+// ApiError is a non 2xx response from the twitch api
+type ApiError struct {
+	Status  int    `json:"status"`
+	Err     string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *ApiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("twitch api error: %d %s", e.Status, e.Err)
+	}
+	return fmt.Sprintf("twitch api error: %d %s: %s", e.Status, e.Err, e.Message)
+}
+
+// the access token expired or was revoked, other 401s like a missing scope
+// are not fixed by a refresh
+func (e *ApiError) invalidToken() bool {
+	return e.Status == http.StatusUnauthorized && strings.Contains(strings.ToLower(e.Message), "invalid oauth token")
+}
+
+// bearer token sent with a helix request
+type authType int
+
+const (
+	// user access token, needed to act on behalf of the user
+	userAuth authType = iota
+	// app access token from the client credentials flow
+	appAuth
+)
+
+// hands out the bearer token of an authType
+type tokenSource interface {
+	Token(ctx context.Context) (string, error)
+	// renews the token after twitch rejected stale
+	Refresh(ctx context.Context, stale string) error
+}
+
+// shared request pipeline for every helix endpoint
+type helixClient struct {
+	env        *bot.Env
+	baseUrl    string
+	httpClient *http.Client
+	userTokens *TokenSource
+	appTokens  *AppTokenSource
+	// twitch keeps a separate bucket for the app and the user token
+	limiters [2]rateLimiter
+}
+
+func newHelixClient(env *bot.Env, httpClient *http.Client, userTokens *TokenSource, appTokens *AppTokenSource) *helixClient {
+	return &helixClient{
+		env:        env,
+		baseUrl:    helixBaseUrl,
+		httpClient: httpClient,
+		userTokens: userTokens,
+		appTokens:  appTokens,
+	}
+}
+
+func (h *helixClient) tokens(auth authType) tokenSource {
+	if auth == appAuth {
+		return h.appTokens
+	}
+	return h.userTokens
+}
+
+func (h *helixClient) limiter(auth authType) *rateLimiter {
+	return &h.limiters[auth]
+}
+
+type helixRequest struct {
+	auth authType
+	// overrides the client base url when not empty
+	baseUrl string
+	method  string
+	// endpoint path relative to the base url, eg. "/users"
+	path  string
+	query url.Values
+	// encoded as json when not nil
+	body any
+}
+
+// a post may create something twice when it is sent again
+func (r *helixRequest) idempotent() bool {
+	return r.method != http.MethodPost
+}
+
+// the connection failed before any byte of the request was written
+func dialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// sends the request and decodes a 2xx json body into out, out can be nil
+//
+// requests are paced by the rate limit bucket, 429, 5xx and network errors
+// are retried until helixMaxRetries or the context is done; posts are only
+// retried after a 429 or when the connection could not be made, a 401 for an
+// invalid token is retried once with a refreshed access token
+func (h *helixClient) do(ctx context.Context, r *helixRequest, out any) error {
+	base := h.baseUrl
+	if r.baseUrl != "" {
+		base = r.baseUrl
+	}
+	u := strings.TrimSuffix(base, "/") + r.path
+	if len(r.query) > 0 {
+		u += "?" + r.query.Encode()
+	}
+	var body []byte
+	if r.body != nil {
+		b, err := json.Marshal(r.body)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+	tokens := h.tokens(r.auth)
+	limiter := h.limiter(r.auth)
+	refreshed := false
+	for attempt := 0; ; attempt++ {
+		token, err := tokens.Token(ctx)
+		if err != nil {
+			return err
+		}
+		if err := limiter.wait(ctx); err != nil {
+			return err
+		}
+		status, b, err := h.send(ctx, limiter, r.method, u, body, token)
+		if err != nil {
+			if ctx.Err() != nil || attempt == helixMaxRetries || !(r.idempotent() || dialError(err)) {
+				return err
+			}
+			if err := sleep(ctx, backoff(attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+		if status == http.StatusUnauthorized && !refreshed {
+			if apiErr := parseApiError(status, b); !apiErr.invalidToken() {
+				return apiErr
+			}
+			refreshed = true
+			if err := tokens.Refresh(ctx, token); err != nil {
+				return err
+			}
+			attempt--
+			continue
+		}
+		if status == http.StatusTooManyRequests && attempt < helixMaxRetries {
+			if err := sleep(ctx, limiter.retryAfter()); err != nil {
+				return err
+			}
+			continue
+		}
+		if status >= 500 && r.idempotent() && attempt < helixMaxRetries {
+			if err := sleep(ctx, backoff(attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+		if status < 200 || status > 299 {
+			return parseApiError(status, b)
+		}
+		if out == nil || len(b) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(b, out); err != nil {
+			return fmt.Errorf("error parsing json response: %w", err)
+		}
+		return nil
+	}
+}
+
+// a single attempt, returns the status and the body of the response
+func (h *helixClient) send(ctx context.Context, limiter *rateLimiter, method string, u string, body []byte, token string) (int, []byte, error) {
+	var rb io.Reader
+	if body != nil {
+		rb = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, rb)
+	if err != nil {
+		return 0, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("Client-Id", h.env.ClientId)
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	limiter.update(resp.Header)
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, b, nil
+}
+
+func parseApiError(status int, b []byte) *ApiError {
+	e := &ApiError{}
+	if json.Unmarshal(b, e) != nil {
+		e.Message = strings.TrimSpace(string(b))
+	}
+	e.Status = status
+	if e.Err == "" {
+		e.Err = http.StatusText(status)
+	}
+	return e
+}
+
+func helixGet[T any](ctx context.Context, h *helixClient, auth authType, path string, query url.Values) (TwitchResponse[T], error) {
+	var res TwitchResponse[T]
+	err := h.do(ctx, &helixRequest{auth: auth, method: http.MethodGet, path: path, query: query}, &res)
+	return res, err
+}
+
+// follows the pagination cursor and returns the data of every page
+func helixGetAll[T any](ctx context.Context, h *helixClient, auth authType, path string, query url.Values) ([]T, error) {
+	all := []T{}
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	for {
+		res, err := helixGet[T](ctx, h, auth, path, q)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, res.Data...)
+		if res.Pagination.Cursor == "" || len(res.Data) == 0 {
+			return all, nil
+		}
+		q.Set("after", res.Pagination.Cursor)
+	}
+}
+
+func helixPost[T any](ctx context.Context, h *helixClient, auth authType, path string, query url.Values, body any) (TwitchResponse[T], error) {
+	var res TwitchResponse[T]
+	err := h.do(ctx, &helixRequest{auth: auth, method: http.MethodPost, path: path, query: query, body: body}, &res)
+	return res, err
+}
+
+func helixPatch(ctx context.Context, h *helixClient, auth authType, path string, query url.Values, body any) error {
+	return h.do(ctx, &helixRequest{auth: auth, method: http.MethodPatch, path: path, query: query, body: body}, nil)
+}
+
+func helixDelete(ctx context.Context, h *helixClient, auth authType, path string, query url.Values) error {
+	return h.do(ctx, &helixRequest{auth: auth, method: http.MethodDelete, path: path, query: query}, nil)
+}
@@ -0,0 +1,113 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+// moderation calls act as the env user, who must moderate the channel
+
+// query with the broadcaster and the env user as moderator
+func (t *TwitchApi) moderatorQuery(ctx context.Context, broadcasterId string) (url.Values, error) {
+	moderatorId, err := t.userId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{"broadcaster_id": {broadcasterId}, "moderator_id": {moderatorId}}, nil
+}
+
+// bans a user, or times them out when r.Duration is set
+func (t *TwitchApi) BanUser(ctx context.Context, broadcasterId string, r BanRequest) (Ban, error) {
+	query, err := t.moderatorQuery(ctx, broadcasterId)
+	if err != nil {
+		return Ban{}, err
+	}
+	res, err := helixPost[Ban](ctx, t.helix, userAuth, "/moderation/bans", query, map[string]BanRequest{"data": r})
+	if err != nil {
+		return Ban{}, err
+	}
+	if len(res.Data) == 0 {
+		return Ban{}, errors.New("empty ban response")
+	}
+	return res.Data[0], nil
+}
+
+// removes a ban or a timeout
+func (t *TwitchApi) UnbanUser(ctx context.Context, broadcasterId string, userId string) error {
+	query, err := t.moderatorQuery(ctx, broadcasterId)
+	if err != nil {
+		return err
+	}
+	query.Set("user_id", userId)
+	return helixDelete(ctx, t.helix, userAuth, "/moderation/bans", query)
+}
+
+// deletes a single message, an empty messageId clears the whole chat
+func (t *TwitchApi) DeleteChatMessages(ctx context.Context, broadcasterId string, messageId string) error {
+	query, err := t.moderatorQuery(ctx, broadcasterId)
+	if err != nil {
+		return err
+	}
+	if messageId != "" {
+		query.Set("message_id", messageId)
+	}
+	return helixDelete(ctx, t.helix, userAuth, "/moderation/chat", query)
+}
+
+func (t *TwitchApi) GetChatSettings(ctx context.Context, broadcasterId string) (ChatSettings, error) {
+	query, err := t.moderatorQuery(ctx, broadcasterId)
+	if err != nil {
+		return ChatSettings{}, err
+	}
+	res, err := helixGet[ChatSettings](ctx, t.helix, userAuth, "/chat/settings", query)
+	if err != nil {
+		return ChatSettings{}, err
+	}
+	if len(res.Data) == 0 {
+		return ChatSettings{}, errors.New("empty chat settings response")
+	}
+	return res.Data[0], nil
+}
+
+// only the non nil fields of s are changed
+func (t *TwitchApi) UpdateChatSettings(ctx context.Context, broadcasterId string, s ChatSettings) error {
+	query, err := t.moderatorQuery(ctx, broadcasterId)
+	if err != nil {
+		return err
+	}
+	s.BroadcasterId = ""
+	s.ModeratorId = ""
+	return helixPatch(ctx, t.helix, userAuth, "/chat/settings", query, s)
+}
+
+// needs the broadcaster token
+func (t *TwitchApi) AddModerator(ctx context.Context, broadcasterId string, userId string) error {
+	_, err := helixPost[struct{}](ctx, t.helix, userAuth, "/moderation/moderators", url.Values{"broadcaster_id": {broadcasterId}, "user_id": {userId}}, nil)
+	return err
+}
+
+// needs the broadcaster token
+func (t *TwitchApi) RemoveModerator(ctx context.Context, broadcasterId string, userId string) error {
+	return helixDelete(ctx, t.helix, userAuth, "/moderation/moderators", url.Values{"broadcaster_id": {broadcasterId}, "user_id": {userId}})
+}
+
+// needs the broadcaster token
+func (t *TwitchApi) AddVip(ctx context.Context, broadcasterId string, userId string) error {
+	_, err := helixPost[struct{}](ctx, t.helix, userAuth, "/channels/vips", url.Values{"broadcaster_id": {broadcasterId}, "user_id": {userId}}, nil)
+	return err
+}
+
+// needs the broadcaster token
+func (t *TwitchApi) RemoveVip(ctx context.Context, broadcasterId string, userId string) error {
+	return helixDelete(ctx, t.helix, userAuth, "/channels/vips", url.Values{"broadcaster_id": {broadcasterId}, "user_id": {userId}})
+}
+
+// users banned in the channel, all of them if userIds is empty; needs the broadcaster token
+func (t *TwitchApi) GetBannedUsers(ctx context.Context, broadcasterId string, userIds ...string) ([]BannedUser, error) {
+	query := url.Values{"broadcaster_id": {broadcasterId}, "first": {"100"}}
+	for _, id := range userIds {
+		query.Add("user_id", id)
+	}
+	return helixGetAll[BannedUser](ctx, t.helix, userAuth, "/moderation/banned", query)
+}
@@ -0,0 +1,112 @@
+package twitch
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// retries of a single helix request after a 429, 5xx or network error
+const helixMaxRetries = 3
+
+// first backoff between retries, doubled on every attempt
+const helixRetryBackoff = time.Millisecond * 500
+
+// RateLimit is the helix token bucket as last reported by twitch
+type RateLimit struct {
+	// bucket size, 0 until the first response
+	Limit int
+	// points left until Reset
+	Remaining int
+	// when the bucket is refilled
+	Reset time.Time
+}
+
+// paces requests using the Ratelimit-* response headers
+type rateLimiter struct {
+	mu    sync.Mutex
+	state RateLimit
+}
+
+// blocks until a point is available in the bucket and takes it
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if l.state.Limit == 0 || l.state.Remaining > 0 || !now.Before(l.state.Reset) {
+			if l.state.Remaining > 0 {
+				// reserve the point so concurrent callers don't all spend the last one
+				l.state.Remaining--
+			}
+			l.mu.Unlock()
+			return nil
+		}
+		d := l.state.Reset.Sub(now)
+		l.mu.Unlock()
+		if err := sleep(ctx, d); err != nil {
+			return err
+		}
+		l.mu.Lock()
+		// the bucket is full again once reset has passed
+		if !time.Now().Before(l.state.Reset) {
+			l.state.Remaining = l.state.Limit
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (l *rateLimiter) update(h http.Header) {
+	limit, err := strconv.Atoi(h.Get("Ratelimit-Limit"))
+	if err != nil {
+		return
+	}
+	remaining, err := strconv.Atoi(h.Get("Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(h.Get("Ratelimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state = RateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Unix(reset, 0),
+	}
+}
+
+// time to wait after a 429, until the reset or a short pause when unknown
+func (l *rateLimiter) retryAfter() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if d := time.Until(l.state.Reset); d > 0 {
+		return d
+	}
+	return time.Second
+}
+
+func (l *rateLimiter) get() RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+func backoff(attempt int) time.Duration {
+	return helixRetryBackoff << attempt
+}
+
+// waits for d unless the context is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,43 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"net/url"
+)
+
+const revokeUrl = "https://id.twitch.tv/oauth2/revoke"
+
+// invalidates an access or refresh token
+func (t *TwitchApi) RevokeToken(ctx context.Context, token string) error {
+	body := url.Values{}
+	body.Set("client_id", t.env.ClientId)
+	body.Set("token", token)
+	return postForm(ctx, t.helix.httpClient, revokeUrl, body, nil)
+}
+
+// revokes the user tokens and removes them from the user env file
+//
+// tokens twitch already considers invalid are removed as well
+func (t *TwitchApi) Logout(ctx context.Context) error {
+	accessToken, refreshToken := t.env.Tokens()
+	var errs []error
+	for _, token := range []string{accessToken, refreshToken} {
+		if token == "" {
+			continue
+		}
+		err := t.RevokeToken(ctx, token)
+		var e *tokenError
+		if errors.As(err, &e) && e.Message == "Invalid token" {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	t.tokens.set("", "", 0)
+	return nil
+}
@@ -0,0 +1,197 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redemption statuses a handler can set
+const (
+	RedemptionFulfilled = "FULFILLED"
+	// the points are refunded to the user
+	RedemptionCanceled = "CANCELED"
+)
+
+var RewardScopes = []string{"channel:manage:redemptions"}
+
+// only rewards created by this application can be changed, all calls need
+// the broadcaster token with channel:manage:redemptions
+
+func (t *TwitchApi) CreateCustomReward(ctx context.Context, broadcasterId string, r CustomRewardRequest) (CustomReward, error) {
+	res, err := helixPost[CustomReward](ctx, t.helix, userAuth, "/channel_points/custom_rewards", url.Values{"broadcaster_id": {broadcasterId}}, r)
+	if err != nil {
+		return CustomReward{}, err
+	}
+	if len(res.Data) == 0 {
+		return CustomReward{}, errors.New("empty custom reward response")
+	}
+	return res.Data[0], nil
+}
+
+func (t *TwitchApi) UpdateCustomReward(ctx context.Context, broadcasterId string, id string, r CustomRewardRequest) error {
+	return helixPatch(ctx, t.helix, userAuth, "/channel_points/custom_rewards", url.Values{"broadcaster_id": {broadcasterId}, "id": {id}}, r)
+}
+
+func (t *TwitchApi) DeleteCustomReward(ctx context.Context, broadcasterId string, id string) error {
+	return helixDelete(ctx, t.helix, userAuth, "/channel_points/custom_rewards", url.Values{"broadcaster_id": {broadcasterId}, "id": {id}})
+}
+
+// rewards of the channel, only the ones this application manages when manageable is set
+func (t *TwitchApi) GetCustomRewards(ctx context.Context, broadcasterId string, manageable bool) ([]CustomReward, error) {
+	query := url.Values{"broadcaster_id": {broadcasterId}}
+	if manageable {
+		query.Set("only_manageable_rewards", "true")
+	}
+	res, err := helixGet[CustomReward](ctx, t.helix, userAuth, "/channel_points/custom_rewards", query)
+	return res.Data, err
+}
+
+// sets the status of an unfulfilled redemption to RedemptionFulfilled or RedemptionCanceled
+func (t *TwitchApi) UpdateRedemptionStatus(ctx context.Context, broadcasterId string, rewardId string, redemptionId string, status string) error {
+	query := url.Values{"broadcaster_id": {broadcasterId}, "reward_id": {rewardId}, "id": {redemptionId}}
+	return helixPatch(ctx, t.helix, userAuth, "/channel_points/custom_rewards/redemptions", query, map[string]string{"status": status})
+}
+
+// RewardConfig declares a custom reward of the channel
+type RewardConfig struct {
+	Title string `json:"title"`
+	Cost  int    `json:"cost"`
+	// shown to the user when redeeming
+	Prompt string `json:"prompt"`
+	// disabled rewards are kept but can't be redeemed, defaults to true
+	Enabled         *bool  `json:"enabled"`
+	BackgroundColor string `json:"background_color"`
+	UserInput       bool   `json:"user_input"`
+	// redemptions are fulfilled right away and never reach the handler queue
+	SkipQueue bool `json:"skip_queue"`
+	// chat message sent by the bot on redemption, {user} and {input} are replaced
+	Message string `json:"message"`
+}
+
+// reads a json array of RewardConfig
+func LoadRewardConfig(path string) ([]RewardConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rewards []RewardConfig
+	if err := json.Unmarshal(b, &rewards); err != nil {
+		return nil, fmt.Errorf("invalid reward config %s: %w", path, err)
+	}
+	for _, r := range rewards {
+		if r.Title == "" || r.Cost <= 0 {
+			return nil, fmt.Errorf("invalid reward config %s: every reward needs a title and a cost", path)
+		}
+	}
+	return rewards, nil
+}
+
+func (r RewardConfig) request() CustomRewardRequest {
+	enabled := r.Enabled == nil || *r.Enabled
+	return CustomRewardRequest{
+		Title:                             r.Title,
+		Prompt:                            r.Prompt,
+		Cost:                              r.Cost,
+		IsEnabled:                         &enabled,
+		BackgroundColor:                   r.BackgroundColor,
+		IsUserInputRequired:               &r.UserInput,
+		ShouldRedemptionsSkipRequestQueue: &r.SkipQueue,
+	}
+}
+
+// RewardHandler handles a redemption and returns the status to set,
+// RedemptionFulfilled, RedemptionCanceled or empty to leave it in the queue
+type RewardHandler func(e RedemptionEvent) string
+
+// time a handler result has to reach twitch
+const redemptionUpdateTimeout = time.Second * 10
+
+// Rewards keeps the custom rewards of a channel in sync with a config and
+// dispatches their redemptions to handlers
+type Rewards struct {
+	api           *TwitchApi
+	broadcasterId string
+	mu            sync.RWMutex
+	// by lower case title
+	handlers map[string]RewardHandler
+}
+
+func (t *TwitchApi) NewRewards(broadcasterId string) *Rewards {
+	return &Rewards{api: t, broadcasterId: broadcasterId, handlers: map[string]RewardHandler{}}
+}
+
+// registers the handler of the reward with title
+func (r *Rewards) Handle(title string, h RewardHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[strings.ToLower(title)] = h
+}
+
+// creates and updates the rewards of the config, matched by title
+//
+// rewards created by this application that are not in the config are deleted,
+// rewards created elsewhere are never touched
+func (r *Rewards) Sync(ctx context.Context, config []RewardConfig) error {
+	existing, err := r.api.GetCustomRewards(ctx, r.broadcasterId, true)
+	if err != nil {
+		return err
+	}
+	byTitle := map[string]CustomReward{}
+	for _, reward := range existing {
+		byTitle[strings.ToLower(reward.Title)] = reward
+	}
+	for _, c := range config {
+		key := strings.ToLower(c.Title)
+		if reward, ok := byTitle[key]; ok {
+			delete(byTitle, key)
+			if err := r.api.UpdateCustomReward(ctx, r.broadcasterId, reward.Id, c.request()); err != nil {
+				return fmt.Errorf("update reward %s: %w", c.Title, err)
+			}
+			continue
+		}
+		if _, err := r.api.CreateCustomReward(ctx, r.broadcasterId, c.request()); err != nil {
+			return fmt.Errorf("create reward %s: %w", c.Title, err)
+		}
+	}
+	for _, reward := range byTitle {
+		if err := r.api.DeleteCustomReward(ctx, r.broadcasterId, reward.Id); err != nil {
+			return fmt.Errorf("delete reward %s: %w", reward.Title, err)
+		}
+	}
+	return nil
+}
+
+// eventsub event handler, redemptions of rewards with a handler are passed
+// to it and their status updated with the result
+func (r *Rewards) OnEvent(event any) {
+	e, ok := event.(RedemptionEvent)
+	if !ok || e.BroadcasterUserId != r.broadcasterId {
+		return
+	}
+	r.mu.RLock()
+	h := r.handlers[strings.ToLower(e.Reward.Title)]
+	r.mu.RUnlock()
+	if h == nil {
+		return
+	}
+	// handlers can be slow, don't hold up the event source
+	go func() {
+		status := h(e)
+		// skip queue redemptions arrive fulfilled and can't change
+		if status == "" || e.Status != "unfulfilled" {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), redemptionUpdateTimeout)
+		defer cancel()
+		if err := r.api.UpdateRedemptionStatus(ctx, r.broadcasterId, e.Reward.Id, e.Id, status); err != nil {
+			println("Error updating redemption status:", err.Error())
+		}
+	}()
+}
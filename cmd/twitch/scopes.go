@@ -0,0 +1,76 @@
+package twitch
+
+import "sync"
+
+// requested when the app env has no SCOPES
+var defaultScopes = []string{"user:read:chat", "user:write:chat", "user:edit", "user:manage:chat_color", "user:read:emotes", "chat:edit", "chat:read"}
+
+// scopes needed by the bot features, declared with TwitchApi.RequireScopes
+var (
+	ChatScopes      = []string{"chat:read", "chat:edit"}
+	HelixChatScopes = []string{"user:read:chat", "user:write:chat"}
+	ChatColorScopes = []string{"user:manage:chat_color"}
+	WhisperScopes   = []string{"user:manage:whispers"}
+	ChannelScopes   = []string{"channel:manage:broadcast"}
+	// used by the moderation commands
+	ModerationScopes = []string{"moderator:manage:banned_users", "moderator:manage:chat_settings"}
+	// used by the remaining moderation endpoints, no command requires them
+	ChannelModerationScopes = []string{
+		"moderator:manage:chat_messages",
+		"moderator:read:chat_settings",
+		"channel:manage:moderators",
+		"channel:manage:vips",
+		"moderation:read",
+	}
+)
+
+// scopes required by the features, on top of the configured ones
+type scopeSet struct {
+	mu     sync.Mutex
+	scopes []string
+}
+
+func (s *scopeSet) add(scopes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scopes = unionScopes(s.scopes, scopes)
+}
+
+func (s *scopeSet) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.scopes...)
+}
+
+// declares scopes a feature needs, they are requested on authorization
+// and checked when the token is validated
+func (t *TwitchApi) RequireScopes(scopes ...string) {
+	t.scopes.add(scopes...)
+}
+
+// configured scopes plus the ones required by features
+func (t *TwitchApi) Scopes() []string {
+	configured := t.env.Scopes
+	if len(configured) == 0 {
+		configured = defaultScopes
+	}
+	return unionScopes(configured, t.scopes.list())
+}
+
+// a followed by the scopes of b not in a
+func unionScopes(a []string, b []string) []string {
+	u := append([]string{}, a...)
+	for _, s := range b {
+		found := false
+		for _, e := range u {
+			if e == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			u = append(u, s)
+		}
+	}
+	return u
+}
@@ -0,0 +1,36 @@
+package twitch
+
+import (
+	"context"
+	"net/url"
+)
+
+// live streams of the given users, offline users are left out
+func (t *TwitchApi) GetStreams(ctx context.Context, userIds []string, userLogins []string) ([]Stream, error) {
+	query := url.Values{}
+	for _, id := range userIds {
+		query.Add("user_id", id)
+	}
+	for _, login := range userLogins {
+		query.Add("user_login", login)
+	}
+	query.Set("first", "100")
+	res, err := helixGet[Stream](ctx, t.helix, appAuth, "/streams", query)
+	return res.Data, err
+}
+
+func (t *TwitchApi) GetChannelInformation(ctx context.Context, broadcasterIds ...string) ([]ChannelInfo, error) {
+	res, err := helixGet[ChannelInfo](ctx, t.helix, appAuth, "/channels", url.Values{"broadcaster_id": broadcasterIds})
+	return res.Data, err
+}
+
+// needs the broadcaster user token with channel:manage:broadcast
+func (t *TwitchApi) ModifyChannelInformation(ctx context.Context, broadcasterId string, r ModifyChannelRequest) error {
+	return helixPatch(ctx, t.helix, userAuth, "/channels", url.Values{"broadcaster_id": {broadcasterId}}, r)
+}
+
+// categories (games) matching the query, best match first
+func (t *TwitchApi) SearchCategories(ctx context.Context, query string) ([]Category, error) {
+	res, err := helixGet[Category](ctx, t.helix, appAuth, "/search/categories", url.Values{"query": {query}})
+	return res.Data, err
+}
@@ -0,0 +1,49 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// websocket subscriptions need a user token, webhook subscriptions an app token
+//
+// sent to the EVENTSUB_API_URL of the env when set, eg. a local mock server
+func (t *TwitchApi) CreateEventSubSubscription(ctx context.Context, r SubscriptionRequest) (Subscription, error) {
+	auth := userAuth
+	if r.Transport.Method == "webhook" {
+		auth = appAuth
+	}
+	var res TwitchResponse[Subscription]
+	err := t.helix.do(ctx, &helixRequest{auth: auth, baseUrl: t.env.EventSubApiUrl, method: http.MethodPost, path: "/eventsub/subscriptions", body: r}, &res)
+	if err != nil {
+		return Subscription{}, err
+	}
+	if len(res.Data) == 0 {
+		return Subscription{}, errors.New("empty subscription response")
+	}
+	return res.Data[0], nil
+}
+
+// creates the subscriptions with the given transport, existing ones are kept
+func (t *TwitchApi) Subscribe(ctx context.Context, subs []SubscriptionRequest, transport SubscriptionTransport) error {
+	for _, s := range subs {
+		s.Transport = transport
+		_, err := t.CreateEventSubSubscription(ctx, s)
+		var apiErr *ApiError
+		// already subscribed
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("eventsub subscription %s: %w", s.Type, err)
+		}
+	}
+	return nil
+}
+
+func (t *TwitchApi) DeleteEventSubSubscription(ctx context.Context, id string) error {
+	return t.helix.do(ctx, &helixRequest{auth: appAuth, baseUrl: t.env.EventSubApiUrl, method: http.MethodDelete, path: "/eventsub/subscriptions", query: url.Values{"id": {id}}}, nil)
+}
@@ -0,0 +1,164 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tcode92/twitch-bot/cmd/bot"
+)
+
+const tokenUrl = "https://id.twitch.tv/oauth2/token"
+
+// the access token is refreshed this long before it expires
+const tokenRefreshMargin = time.Minute * 10
+
+// how often the background refresh checks the expiry
+const tokenCheckInterval = time.Minute
+
+// TokenSource hands out the user access token and refreshes it when needed
+//
+// refreshed tokens are stored in the env, so they are used by the irc login
+// and saved to the user env file
+type TokenSource struct {
+	env        *bot.Env
+	httpClient *http.Client
+	// serializes refreshes
+	mu sync.Mutex
+	// zero when unknown
+	expiry time.Time
+}
+
+func newTokenSource(env *bot.Env, httpClient *http.Client) *TokenSource {
+	return &TokenSource{env: env, httpClient: httpClient}
+}
+
+// current access token, refreshed first if it is about to expire
+//
+// a failed refresh only fails once the token has expired, until then the
+// background refresh or a 401 tries again
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	accessToken, _ := s.env.Tokens()
+	if s.expiresWithin(tokenRefreshMargin) {
+		if err := s.Refresh(ctx, accessToken); err != nil {
+			if s.expiresWithin(0) {
+				return "", err
+			}
+			return accessToken, nil
+		}
+		accessToken, _ = s.env.Tokens()
+	}
+	return accessToken, nil
+}
+
+// refreshes the access token unless it already changed from stale
+//
+// callers rejected with stale all refresh at once, only the first one hits twitch
+func (s *TokenSource) Refresh(ctx context.Context, stale string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	accessToken, refreshToken := s.env.Tokens()
+	if accessToken != stale {
+		return nil
+	}
+	body := url.Values{}
+	body.Set("client_id", s.env.ClientId)
+	body.Set("client_secret", s.env.ClientSecret)
+	body.Set("grant_type", "refresh_token")
+	body.Set("refresh_token", refreshToken)
+	var token RefreshTokenResponse
+	if err := postToken(ctx, s.httpClient, body, &token); err != nil {
+		return err
+	}
+	s.env.SetTokens(token.AccessToken, token.RefreshToken)
+	s.expiry = expiryFromNow(token.Expire)
+	return nil
+}
+
+// refreshes the token in the background before it expires, until ctx is done
+func (s *TokenSource) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(tokenCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !s.expiresWithin(tokenRefreshMargin) {
+				continue
+			}
+			accessToken, _ := s.env.Tokens()
+			if err := s.Refresh(ctx, accessToken); err != nil {
+				println("Error refreshing access token:", err.Error())
+			}
+		}
+	}()
+}
+
+// stores tokens obtained outside of a refresh, eg. from the code flow
+func (s *TokenSource) set(accessToken string, refreshToken string, expiresIn int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.env.SetTokens(accessToken, refreshToken)
+	s.expiry = expiryFromNow(expiresIn)
+}
+
+// records the expiry reported by the validate endpoint
+func (s *TokenSource) setExpiry(expiresIn int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expiry = expiryFromNow(expiresIn)
+}
+
+func (s *TokenSource) expiresWithin(d time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.expiry.IsZero() && time.Until(s.expiry) < d
+}
+
+// zero when twitch reports no expiry
+func expiryFromNow(expiresIn int32) time.Time {
+	if expiresIn <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(expiresIn) * time.Second)
+}
+
+// posts a form to the oauth token endpoint and decodes the response into out
+func postToken(ctx context.Context, client *http.Client, body url.Values, out any) error {
+	return postForm(ctx, client, tokenUrl, body, out)
+}
+
+// posts a form to an oauth endpoint, failures are returned as *tokenError
+func postForm(ctx context.Context, client *http.Client, u string, body url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(body.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		e := &tokenError{}
+		json.Unmarshal(respBody, e)
+		return e
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
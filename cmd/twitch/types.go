@@ -1,5 +1,7 @@
 package twitch
 
+import "time"
+
 type UserInfo struct {
 	Id              string `json:"id"`
 	Login           string `json:"login"`
@@ -13,7 +15,15 @@ type UserInfo struct {
 }
 
 type TwitchResponse[T any] struct {
-	Data []T `json:"data"`
+	Data       []T        `json:"data"`
+	Pagination Pagination `json:"pagination"`
+	// only set by endpoints returning a total count
+	Total int `json:"total"`
+}
+
+type Pagination struct {
+	// empty on the last page
+	Cursor string `json:"cursor"`
 }
 type TokenResponse struct {
 	AccessToken  string   `json:"access_token"`
@@ -31,3 +41,172 @@ type tokenError struct {
 	Status  int16  `json:"status"`
 	Message string `json:"message"`
 }
+
+func (e *tokenError) Error() string {
+	return "twitch auth error: " + e.Message
+}
+
+type DeviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationUri string `json:"verification_uri"`
+	Expire          int32  `json:"expires_in"`
+	// seconds to wait between token polls
+	Interval int32 `json:"interval"`
+}
+
+type Stream struct {
+	Id           string    `json:"id"`
+	UserId       string    `json:"user_id"`
+	UserLogin    string    `json:"user_login"`
+	UserName     string    `json:"user_name"`
+	GameId       string    `json:"game_id"`
+	GameName     string    `json:"game_name"`
+	Type         string    `json:"type"`
+	Title        string    `json:"title"`
+	ViewerCount  int       `json:"viewer_count"`
+	StartedAt    time.Time `json:"started_at"`
+	Language     string    `json:"language"`
+	ThumbnailUrl string    `json:"thumbnail_url"`
+	Tags         []string  `json:"tags"`
+	IsMature     bool      `json:"is_mature"`
+}
+
+type ChannelInfo struct {
+	BroadcasterId       string   `json:"broadcaster_id"`
+	BroadcasterLogin    string   `json:"broadcaster_login"`
+	BroadcasterName     string   `json:"broadcaster_name"`
+	BroadcasterLanguage string   `json:"broadcaster_language"`
+	GameId              string   `json:"game_id"`
+	GameName            string   `json:"game_name"`
+	Title               string   `json:"title"`
+	Delay               int      `json:"delay"`
+	Tags                []string `json:"tags"`
+}
+
+// fields left empty are not changed
+type ModifyChannelRequest struct {
+	GameId              string   `json:"game_id,omitempty"`
+	Title               string   `json:"title,omitempty"`
+	BroadcasterLanguage string   `json:"broadcaster_language,omitempty"`
+	Tags                []string `json:"tags,omitempty"`
+}
+
+type Category struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	BoxArtUrl string `json:"box_art_url"`
+}
+
+type SendChatMessageRequest struct {
+	BroadcasterId string `json:"broadcaster_id"`
+	SenderId      string `json:"sender_id"`
+	Message       string `json:"message"`
+	// empty for a message that doesn't reply
+	ReplyParentMessageId string `json:"reply_parent_message_id,omitempty"`
+}
+
+type SentChatMessage struct {
+	MessageId string `json:"message_id"`
+	IsSent    bool   `json:"is_sent"`
+	// set when the message was dropped
+	DropReason *DropReason `json:"drop_reason"`
+}
+
+type DropReason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type BanRequest struct {
+	UserId string `json:"user_id"`
+	// timeout in seconds, 0 bans permanently
+	Duration int    `json:"duration,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type Ban struct {
+	BroadcasterId string    `json:"broadcaster_id"`
+	ModeratorId   string    `json:"moderator_id"`
+	UserId        string    `json:"user_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	// nil for a permanent ban
+	EndTime *time.Time `json:"end_time"`
+}
+
+type BannedUser struct {
+	UserId         string    `json:"user_id"`
+	UserLogin      string    `json:"user_login"`
+	UserName       string    `json:"user_name"`
+	ExpiresAt      string    `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+	Reason         string    `json:"reason"`
+	ModeratorId    string    `json:"moderator_id"`
+	ModeratorLogin string    `json:"moderator_login"`
+	ModeratorName  string    `json:"moderator_name"`
+}
+
+// nil fields are left unchanged by UpdateChatSettings
+type ChatSettings struct {
+	BroadcasterId                 string `json:"broadcaster_id,omitempty"`
+	EmoteMode                     *bool  `json:"emote_mode,omitempty"`
+	FollowerMode                  *bool  `json:"follower_mode,omitempty"`
+	FollowerModeDuration          *int   `json:"follower_mode_duration,omitempty"`
+	ModeratorId                   string `json:"moderator_id,omitempty"`
+	NonModeratorChatDelay         *bool  `json:"non_moderator_chat_delay,omitempty"`
+	NonModeratorChatDelayDuration *int   `json:"non_moderator_chat_delay_duration,omitempty"`
+	SlowMode                      *bool  `json:"slow_mode,omitempty"`
+	SlowModeWaitTime              *int   `json:"slow_mode_wait_time,omitempty"`
+	SubscriberMode                *bool  `json:"subscriber_mode,omitempty"`
+	UniqueChatMode                *bool  `json:"unique_chat_mode,omitempty"`
+}
+
+type SubscriptionRequest struct {
+	Type      string                `json:"type"`
+	Version   string                `json:"version"`
+	Condition map[string]string     `json:"condition"`
+	Transport SubscriptionTransport `json:"transport"`
+}
+
+type SubscriptionTransport struct {
+	// websocket or webhook
+	Method    string `json:"method"`
+	SessionId string `json:"session_id,omitempty"`
+	Callback  string `json:"callback,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+}
+
+type Subscription struct {
+	Id        string                `json:"id"`
+	Status    string                `json:"status"`
+	Type      string                `json:"type"`
+	Version   string                `json:"version"`
+	Condition map[string]string     `json:"condition"`
+	CreatedAt time.Time             `json:"created_at"`
+	Transport SubscriptionTransport `json:"transport"`
+	Cost      int                   `json:"cost"`
+}
+
+type CustomReward struct {
+	Id                                string `json:"id"`
+	BroadcasterId                     string `json:"broadcaster_id"`
+	Title                             string `json:"title"`
+	Prompt                            string `json:"prompt"`
+	Cost                              int    `json:"cost"`
+	IsEnabled                         bool   `json:"is_enabled"`
+	IsPaused                          bool   `json:"is_paused"`
+	BackgroundColor                   string `json:"background_color"`
+	IsUserInputRequired               bool   `json:"is_user_input_required"`
+	ShouldRedemptionsSkipRequestQueue bool   `json:"should_redemptions_skip_request_queue"`
+}
+
+// body of create and update custom reward, nil fields are not changed on update
+type CustomRewardRequest struct {
+	Title                             string `json:"title,omitempty"`
+	Prompt                            string `json:"prompt,omitempty"`
+	Cost                              int    `json:"cost,omitempty"`
+	IsEnabled                         *bool  `json:"is_enabled,omitempty"`
+	BackgroundColor                   string `json:"background_color,omitempty"`
+	IsUserInputRequired               *bool  `json:"is_user_input_required,omitempty"`
+	ShouldRedemptionsSkipRequestQueue *bool  `json:"should_redemptions_skip_request_queue,omitempty"`
+}
@@ -1,41 +1,116 @@
 package twitch
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
-	"net/http"
+	"context"
+	"net/url"
+	"strings"
 )
 
-func (t *TwitchApi) GetUserInfo(user string) (UserInfo, error) {
-	var u = TwitchResponse[UserInfo]{}
-	client := &http.Client{}
+// max ids and logins in a single get users request
+const maxUsersPerRequest = 100
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://api.twitch.tv/helix/users?login=%s", user), nil)
+// UsersNotFoundError lists the requested users twitch doesn't know
+type UsersNotFoundError struct {
+	Ids    []string
+	Logins []string
+}
+
+func (e *UsersNotFoundError) Error() string {
+	return "users not found: " + strings.Join(append(append([]string{}, e.Ids...), e.Logins...), ", ")
+}
+
+// user lookups don't need the user token, the app token keeps working when it expires
+func (t *TwitchApi) GetUserInfo(ctx context.Context, user string) (UserInfo, error) {
+	users, err := t.GetUsers(ctx, nil, []string{user})
 	if err != nil {
 		return UserInfo{}, err
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.env.AccessToken))
-	req.Header.Set("Client-Id", t.env.ClientId)
+	return users[0], nil
+}
 
-	resp, err := client.Do(req)
+// user id of the env user, the owner of the user token
+func (t *TwitchApi) userId(ctx context.Context) (string, error) {
+	u, err := t.GetUserInfo(ctx, t.env.UserName)
 	if err != nil {
-		return UserInfo{}, err
+		return "", err
 	}
-	defer resp.Body.Close()
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return UserInfo{}, err
+	return u.Id, nil
+}
+
+// looks up users by id and login, up to 100 per helix request
+//
+// cached users are not requested again, users twitch doesn't know are
+// reported with a *UsersNotFoundError next to the ones found
+func (t *TwitchApi) GetUsers(ctx context.Context, ids []string, logins []string) ([]UserInfo, error) {
+	users := []UserInfo{}
+	query := url.Values{}
+	var missingIds, missingLogins []string
+	for _, id := range ids {
+		if u, ok := t.users.getById(id); ok {
+			users = append(users, u)
+		} else {
+			missingIds = append(missingIds, id)
+			query.Add("id", id)
+		}
+	}
+	for _, login := range logins {
+		if u, ok := t.users.getByLogin(login); ok {
+			users = append(users, u)
+		} else {
+			missingLogins = append(missingLogins, login)
+			query.Add("login", login)
+		}
 	}
-	if resp.StatusCode == 200 {
-		err := json.Unmarshal(b, &u)
+
+	found := map[string]bool{}
+	for _, batch := range batchQuery(query, maxUsersPerRequest) {
+		res, err := helixGet[UserInfo](ctx, t.helix, appAuth, "/users", batch)
 		if err != nil {
-			return UserInfo{}, errors.New("error parsing json response")
+			return users, err
+		}
+		for _, u := range res.Data {
+			t.users.add(u)
+			users = append(users, u)
+			found[u.Id] = true
+			found["login:"+strings.ToLower(u.Login)] = true
+		}
+	}
+
+	notFound := &UsersNotFoundError{}
+	for _, id := range missingIds {
+		if !found[id] {
+			notFound.Ids = append(notFound.Ids, id)
+		}
+	}
+	for _, login := range missingLogins {
+		if !found["login:"+strings.ToLower(login)] {
+			notFound.Logins = append(notFound.Logins, login)
 		}
-		return u.Data[0], nil
+	}
+	if len(notFound.Ids) > 0 || len(notFound.Logins) > 0 {
+		return users, notFound
+	}
+	return users, nil
+}
 
-	} else {
-		return UserInfo{}, errors.New("invalid response")
+// splits the values of query into queries holding at most n values in total
+func batchQuery(query url.Values, n int) []url.Values {
+	batches := []url.Values{}
+	batch := url.Values{}
+	count := 0
+	for key, values := range query {
+		for _, v := range values {
+			if count == n {
+				batches = append(batches, batch)
+				batch = url.Values{}
+				count = 0
+			}
+			batch.Add(key, v)
+			count++
+		}
+	}
+	if count > 0 {
+		batches = append(batches, batch)
 	}
+	return batches
 }
@@ -0,0 +1,159 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const validateUrl = "https://id.twitch.tv/oauth2/validate"
+
+// twitch requires the token to be validated at startup and hourly after that
+const validateInterval = time.Hour
+
+type ValidateResponse struct {
+	ClientId  string   `json:"client_id"`
+	Login     string   `json:"login"`
+	Scopes    []string `json:"scopes"`
+	UserId    string   `json:"user_id"`
+	ExpiresIn int32    `json:"expires_in"`
+}
+
+// MissingScopesError is returned when the token lacks required scopes
+type MissingScopesError struct {
+	Scopes []string
+}
+
+func (e *MissingScopesError) Error() string {
+	return "token is missing scopes: " + strings.Join(e.Scopes, " ")
+}
+
+// validates the access token, an invalid token is reported as an *ApiError with status 401
+func (t *TwitchApi) ValidateToken(ctx context.Context) (ValidateResponse, error) {
+	var v ValidateResponse
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, validateUrl, nil)
+	if err != nil {
+		return v, err
+	}
+	accessToken, _ := t.env.Tokens()
+	req.Header.Set("Authorization", fmt.Sprintf("OAuth %s", accessToken))
+
+	resp, err := t.helix.httpClient.Do(req)
+	if err != nil {
+		return v, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return v, err
+	}
+	if resp.StatusCode != 200 {
+		return v, parseApiError(resp.StatusCode, b)
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, err
+	}
+	t.tokens.setExpiry(v.ExpiresIn)
+	return v, nil
+}
+
+// TokenValidator validates the user token at startup and every hour after that
+type TokenValidator struct {
+	api *TwitchApi
+	// scopes the token must hold
+	Scopes []string
+	// called when the token can't be used anymore, eg. revoked and not refreshable,
+	// issued for another user or missing scopes
+	OnInvalid func(err error)
+}
+
+// the validator requires the scopes known to the api at creation
+func (t *TwitchApi) NewTokenValidator() *TokenValidator {
+	return &TokenValidator{api: t, Scopes: t.Scopes()}
+}
+
+// validates the token, refreshing it once if twitch rejects it, and checks
+// that it belongs to the env user and holds the required scopes
+func (v *TokenValidator) Validate(ctx context.Context) (ValidateResponse, error) {
+	res, err := v.api.ValidateToken(ctx)
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized {
+		accessToken, _ := v.api.env.Tokens()
+		if err := v.api.tokens.Refresh(ctx, accessToken); err != nil {
+			return res, fmt.Errorf("token revoked and refresh failed: %w", err)
+		}
+		res, err = v.api.ValidateToken(ctx)
+	}
+	if err != nil {
+		return res, err
+	}
+	if v.api.env.UserName != "" && !strings.EqualFold(res.Login, v.api.env.UserName) {
+		return res, fmt.Errorf("token belongs to %s, not %s", res.Login, v.api.env.UserName)
+	}
+	if missing := missingScopes(res.Scopes, v.Scopes); len(missing) > 0 {
+		return res, &MissingScopesError{Scopes: missing}
+	}
+	return res, nil
+}
+
+// validates the token every hour until ctx is done
+//
+// network errors are retried on the next tick, any other failure is passed to OnInvalid
+func (v *TokenValidator) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(validateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			_, err := v.Validate(ctx)
+			if err == nil {
+				continue
+			}
+			println("Token validation failed:", err.Error())
+			if isNetworkError(err) || ctx.Err() != nil {
+				continue
+			}
+			if v.OnInvalid != nil {
+				v.OnInvalid(err)
+			}
+		}
+	}()
+}
+
+// scopes in required that are not in granted
+func missingScopes(granted []string, required []string) []string {
+	missing := []string{}
+	for _, r := range required {
+		found := false
+		for _, g := range granted {
+			if g == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// true when twitch couldn't be reached or failed, the token may still be valid
+func isNetworkError(err error) bool {
+	var apiErr *ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
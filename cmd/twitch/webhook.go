@@ -0,0 +1,118 @@
+package twitch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhook messages older than this are rejected as replays
+const webhookMaxAge = time.Minute * 10
+
+// largest notification body accepted
+const webhookMaxBody = 1 << 20
+
+// WebhookHandler receives eventsub notifications sent to a webhook callback
+//
+// every request is verified with the subscription secret, duplicate and old
+// messages are dropped
+type WebhookHandler struct {
+	// secret given when creating the webhook subscriptions
+	secret []byte
+	// called with the decoded event of every notification, one of the *Event
+	// types or UnknownEvent
+	OnEvent func(event any)
+	// called when twitch revokes a subscription
+	OnRevocation func(s Subscription)
+	seen         *messageIds
+}
+
+func NewWebhookHandler(secret string) *WebhookHandler {
+	return &WebhookHandler{
+		secret: []byte(secret),
+		seen:   newMessageIds(webhookMaxAge),
+	}
+}
+
+type webhookMessage struct {
+	Challenge    string          `json:"challenge"`
+	Subscription Subscription    `json:"subscription"`
+	Event        json.RawMessage `json:"event"`
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, webhookMaxBody+1))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if len(body) > webhookMaxBody {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	id := r.Header.Get("Twitch-Eventsub-Message-Id")
+	timestamp := r.Header.Get("Twitch-Eventsub-Message-Timestamp")
+	if !h.verify(id, timestamp, body, r.Header.Get("Twitch-Eventsub-Message-Signature")) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	ts, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil || time.Since(ts) > webhookMaxAge || time.Until(ts) > webhookMaxAge {
+		http.Error(w, "message too old", http.StatusForbidden)
+		return
+	}
+	// twitch retries until it gets a 2xx, a duplicate is acknowledged and dropped
+	if !h.seen.add(id) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var m webhookMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		// not handled, the retry must not be dropped as a duplicate
+		h.seen.remove(id)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	switch r.Header.Get("Twitch-Eventsub-Message-Type") {
+	case "webhook_callback_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, m.Challenge)
+		return
+	case "notification":
+		event, err := decodeEvent(m.Subscription.Type, m.Event)
+		if err != nil {
+			println("Invalid eventsub event:", err.Error())
+			h.seen.remove(id)
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		if h.OnEvent != nil {
+			h.OnEvent(event)
+		}
+	case "revocation":
+		if h.OnRevocation != nil {
+			h.OnRevocation(m.Subscription)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checks the hmac-sha256 signature over id, timestamp and body
+func (h *WebhookHandler) verify(id string, timestamp string, body []byte, signature string) bool {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(id))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,167 @@
+package twitch
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "0123456789abcdef"
+
+const testFollowNotification = `{
+	"subscription": {"id": "sub-1", "status": "enabled", "type": "channel.follow", "version": "2"},
+	"event": {"user_id": "1", "user_login": "viewer", "user_name": "Viewer", "broadcaster_user_id": "2", "broadcaster_user_login": "streamer", "broadcaster_user_name": "Streamer"}
+}`
+
+// a request signed with secret the way twitch signs its deliveries
+func webhookRequest(secret string, id string, messageType string, ts time.Time, body string) *http.Request {
+	timestamp := ts.UTC().Format(time.RFC3339Nano)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id + timestamp + body))
+	r := httptest.NewRequest(http.MethodPost, "/eventsub", strings.NewReader(body))
+	r.Header.Set("Twitch-Eventsub-Message-Id", id)
+	r.Header.Set("Twitch-Eventsub-Message-Timestamp", timestamp)
+	r.Header.Set("Twitch-Eventsub-Message-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	r.Header.Set("Twitch-Eventsub-Message-Type", messageType)
+	return r
+}
+
+// handler under test and the events it dispatched
+func newTestWebhook() (*WebhookHandler, *[]any) {
+	events := []any{}
+	h := NewWebhookHandler(testWebhookSecret)
+	h.OnEvent = func(event any) {
+		events = append(events, event)
+	}
+	return h, &events
+}
+
+func serveWebhook(h *WebhookHandler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestWebhookNotification(t *testing.T) {
+	h, events := newTestWebhook()
+	w := serveWebhook(h, webhookRequest(testWebhookSecret, "msg-1", "notification", time.Now(), testFollowNotification))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if len(*events) != 1 {
+		t.Fatalf("%d events dispatched, want 1", len(*events))
+	}
+	e, ok := (*events)[0].(FollowEvent)
+	if !ok {
+		t.Fatalf("event is %T, want FollowEvent", (*events)[0])
+	}
+	if e.UserName != "Viewer" || e.BroadcasterUserLogin != "streamer" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	h, events := newTestWebhook()
+	w := serveWebhook(h, webhookRequest("another secret", "msg-1", "notification", time.Now(), testFollowNotification))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	// a tampered body doesn't match the signature of the original one
+	r := webhookRequest(testWebhookSecret, "msg-2", "notification", time.Now(), testFollowNotification)
+	r.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Replace(testFollowNotification, "Viewer", "Admin", 1))).Body
+	if w := serveWebhook(h, r); w.Code != http.StatusForbidden {
+		t.Fatalf("tampered body: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if len(*events) != 0 {
+		t.Fatalf("%d events dispatched, want 0", len(*events))
+	}
+}
+
+func TestWebhookChallenge(t *testing.T) {
+	h, _ := newTestWebhook()
+	body := `{"challenge": "pogchamp-kappa-360noscope-vohiyo", "subscription": {"id": "sub-1", "status": "webhook_callback_verification_pending", "type": "channel.follow"}}`
+	w := serveWebhook(h, webhookRequest(testWebhookSecret, "msg-1", "webhook_callback_verification", time.Now(), body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Body.String(); got != "pogchamp-kappa-360noscope-vohiyo" {
+		t.Fatalf("body %q, want the challenge", got)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Fatalf("content type %q, want text/plain", ct)
+	}
+}
+
+func TestWebhookTimestampWindow(t *testing.T) {
+	for _, ts := range []time.Time{
+		time.Now().Add(-webhookMaxAge - time.Minute),
+		time.Now().Add(webhookMaxAge + time.Minute),
+	} {
+		h, events := newTestWebhook()
+		w := serveWebhook(h, webhookRequest(testWebhookSecret, "msg-1", "notification", ts, testFollowNotification))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("timestamp %s: status %d, want %d", ts, w.Code, http.StatusForbidden)
+		}
+		if len(*events) != 0 {
+			t.Fatalf("timestamp %s: %d events dispatched, want 0", ts, len(*events))
+		}
+	}
+}
+
+func TestWebhookDuplicate(t *testing.T) {
+	h, events := newTestWebhook()
+	for i := 0; i < 2; i++ {
+		w := serveWebhook(h, webhookRequest(testWebhookSecret, "msg-1", "notification", time.Now(), testFollowNotification))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("delivery %d: status %d, want %d", i, w.Code, http.StatusNoContent)
+		}
+	}
+	if len(*events) != 1 {
+		t.Fatalf("%d events dispatched, want 1", len(*events))
+	}
+}
+
+func TestWebhookRetryAfterBadRequest(t *testing.T) {
+	for _, body := range []string{
+		`{"subscription": `,
+		`{"subscription": {"type": "channel.follow"}, "event": "not an event"}`,
+	} {
+		h, events := newTestWebhook()
+		w := serveWebhook(h, webhookRequest(testWebhookSecret, "msg-1", "notification", time.Now(), body))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("body %q: status %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+		// the id of a message that failed is not recorded, the retry is handled
+		w = serveWebhook(h, webhookRequest(testWebhookSecret, "msg-1", "notification", time.Now(), testFollowNotification))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("retry: status %d, want %d", w.Code, http.StatusNoContent)
+		}
+		if len(*events) != 1 {
+			t.Fatalf("retry: %d events dispatched, want 1", len(*events))
+		}
+	}
+}
+
+func TestWebhookRevocation(t *testing.T) {
+	h, events := newTestWebhook()
+	revoked := []Subscription{}
+	h.OnRevocation = func(s Subscription) {
+		revoked = append(revoked, s)
+	}
+	body := `{"subscription": {"id": "sub-1", "status": "authorization_revoked", "type": "channel.follow", "version": "2"}}`
+	w := serveWebhook(h, webhookRequest(testWebhookSecret, "msg-1", "revocation", time.Now(), body))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if len(revoked) != 1 || revoked[0].Id != "sub-1" || revoked[0].Status != "authorization_revoked" {
+		t.Fatalf("unexpected revocations %+v", revoked)
+	}
+	if len(*events) != 0 {
+		t.Fatalf("%d events dispatched, want 0", len(*events))
+	}
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/tcode92/twitch-bot/cmd/bot"
+	"github.com/tcode92/twitch-bot/cmd/commands"
 	"github.com/tcode92/twitch-bot/cmd/twitch"
 )
 
@@ -12,29 +20,69 @@ func main() {
 	// parse program arguments and load env from env files
 	env := bot.GetEnv()
 	// twitch api to authenticate and validate tokens
-	twitch := twitch.New(env)
-	// if tokens doesn't exists for any reason the user need to authenticate via browser
-	if env.AccessToken == "" || env.RefreshToken == "" {
-		err := twitch.AuthorizationCodeGrantFlow()
-		if err != nil {
+	api := twitch.New(env)
+	if env.Logout {
+		if err := api.Logout(context.Background()); err != nil {
 			println(err.Error())
 			os.Exit(1)
 		}
-	} else {
-		// validate the tokens and refresh access token if not valid
-		if err := twitch.ValidateToken(); err != nil {
-			println(err.Error())
-			if err.Error() == "invalid access token" {
-				err := twitch.RefreshAccessToken()
-				if err != nil {
-					println(err)
-					os.Exit(1)
-				}
-			}
-		}
+		println("Tokens revoked")
+		return
 	}
 
 	b := bot.New(env)
+	// scopes needed by the enabled features
+	api.RequireScopes(twitch.ChatScopes...)
+	if err := registerCommands(b, &api, env); err != nil {
+		println(err.Error())
+		os.Exit(1)
+	}
+	switch env.ChatBackend {
+	case "", "irc":
+	case "helix":
+		api.RequireScopes(twitch.HelixChatScopes...)
+		// replayed replies go to the replayer, never to twitch
+		if env.ReplayPath == "" {
+			b.Sender = api.ChatSender()
+		}
+	default:
+		println("Unknown chat backend:", env.ChatBackend)
+		os.Exit(1)
+	}
+	switch env.EventSub {
+	case "":
+	case "websocket", "webhook":
+		api.RequireScopes(twitch.EventSubScopes...)
+	default:
+		println("Unknown eventsub transport:", env.EventSub)
+		os.Exit(1)
+	}
+	if env.RewardsPath != "" {
+		// redemptions are only delivered by eventsub
+		if env.EventSub == "" {
+			println("REWARDS needs EVENTSUB to be enabled")
+			os.Exit(1)
+		}
+		api.RequireScopes(twitch.RewardScopes...)
+	}
+	// a replayed session never reaches twitch
+	if env.ReplayPath == "" {
+		authenticate(&api, env)
+		// keep the access token fresh for long running sessions
+		api.Tokens().Start(context.Background())
+		validator := api.NewTokenValidator()
+		validator.OnInvalid = func(err error) {
+			println("Access token is not usable anymore, shutting down:", err.Error())
+			b.Close()
+		}
+		validator.Start(context.Background())
+		if env.EventSub != "" {
+			if err := startEventSub(&api, env, b); err != nil {
+				println(err.Error())
+				os.Exit(1)
+			}
+		}
+	}
 	b.OnMessage = func(m bot.ChatMsg) {
 		b.PrintPretty(&m)
 		if m.User != env.UserName {
@@ -53,6 +101,156 @@ func main() {
 	<-exit
 }
 
+// registers the command groups of the env
+func registerCommands(b *bot.Bot, api *twitch.TwitchApi, env *bot.Env) error {
+	for _, group := range env.Commands {
+		var register func(*bot.Bot, *twitch.TwitchApi)
+		switch group {
+		case "stream":
+			register = commands.RegisterStreamCommands
+		case "moderation":
+			register = commands.RegisterModerationCommands
+		default:
+			return fmt.Errorf("unknown command group: %s", group)
+		}
+		// the commands call helix, a replayed session must not reach twitch
+		if env.ReplayPath == "" {
+			register(b, api)
+		}
+	}
+	return nil
+}
+
+// makes sure the env holds a valid access token
+func authenticate(api *twitch.TwitchApi, env *bot.Env) {
+	authorize := api.AuthorizationCodeGrantFlow
+	// headless machines can't reach a localhost redirect
+	if env.DeviceAuth {
+		authorize = api.DeviceCodeGrantFlow
+	}
+	// if tokens doesn't exists for any reason the user need to authenticate via browser
+	if env.AccessToken == "" || env.RefreshToken == "" {
+		err := authorize()
+		if err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+	}
+	// validate the tokens, the access token is refreshed if not valid
+	_, err := api.NewTokenValidator().Validate(context.Background())
+	var missing *twitch.MissingScopesError
+	if errors.As(err, &missing) && confirm(fmt.Sprintf("%s\nAuthorize again with the missing scopes?", err.Error())) {
+		// the flows request the configured and the required scopes together
+		if err := authorize(); err != nil {
+			println(err.Error())
+			os.Exit(1)
+		}
+		_, err = api.NewTokenValidator().Validate(context.Background())
+	}
+	if err != nil {
+		println(err.Error())
+		os.Exit(1)
+	}
+}
+
+// subscribes to the events of the bot user channel
+func startEventSub(api *twitch.TwitchApi, env *bot.Env, b *bot.Bot) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	user, err := api.GetUserInfo(ctx, env.UserName)
+	if err != nil {
+		return err
+	}
+	onEvent := printEvent
+	if env.RewardsPath != "" {
+		rewards, err := syncRewards(ctx, api, env, b, user)
+		if err != nil {
+			return err
+		}
+		onEvent = func(event any) {
+			printEvent(event)
+			rewards.OnEvent(event)
+		}
+	}
+	subscriptions := twitch.BroadcasterSubscriptions(user.Id, user.Id)
+	onRevocation := func(s twitch.Subscription) {
+		fmt.Printf("EventSub subscription %s revoked: %s\n", s.Type, s.Status)
+	}
+	if env.EventSub == "webhook" {
+		handler := twitch.NewWebhookHandler(env.EventSubSecret)
+		handler.OnEvent = onEvent
+		handler.OnRevocation = onRevocation
+		l, err := net.Listen("tcp", env.EventSubAddr)
+		if err != nil {
+			return err
+		}
+		// twitch verifies the callback while the subscriptions are created
+		go http.Serve(l, handler)
+		return api.Subscribe(ctx, subscriptions, twitch.SubscriptionTransport{
+			Method:   "webhook",
+			Callback: env.EventSubCallback,
+			Secret:   env.EventSubSecret,
+		})
+	}
+	events := api.NewEventSub()
+	events.Subscriptions = subscriptions
+	events.OnEvent = onEvent
+	events.OnRevocation = onRevocation
+	return events.Connect(context.Background())
+}
+
+// syncs the configured rewards, rewards with a message are announced in chat
+func syncRewards(ctx context.Context, api *twitch.TwitchApi, env *bot.Env, b *bot.Bot, user twitch.UserInfo) (*twitch.Rewards, error) {
+	config, err := twitch.LoadRewardConfig(env.RewardsPath)
+	if err != nil {
+		return nil, err
+	}
+	rewards := api.NewRewards(user.Id)
+	if err := rewards.Sync(ctx, config); err != nil {
+		return nil, err
+	}
+	for _, r := range config {
+		if r.Message == "" {
+			continue
+		}
+		message := r.Message
+		rewards.Handle(r.Title, func(e twitch.RedemptionEvent) string {
+			text := strings.NewReplacer("{user}", e.UserName, "{input}", e.UserInput).Replace(message)
+			// a message that didn't reach chat gives the points back
+			if res, err := b.SendMessage(user.Login, text); err != nil || !res.IsSent {
+				return twitch.RedemptionCanceled
+			}
+			return twitch.RedemptionFulfilled
+		})
+	}
+	return rewards, nil
+}
+
+func printEvent(event any) {
+	switch e := event.(type) {
+	case twitch.FollowEvent:
+		fmt.Printf("%s followed %s\n", e.UserName, e.BroadcasterUserName)
+	case twitch.RedemptionEvent:
+		fmt.Printf("%s redeemed %s\n", e.UserName, e.Reward.Title)
+	case twitch.StreamOnlineEvent:
+		fmt.Printf("%s is live\n", e.BroadcasterUserName)
+	case twitch.StreamOfflineEvent:
+		fmt.Printf("%s is offline\n", e.BroadcasterUserName)
+	case twitch.HypeTrainEvent:
+		fmt.Printf("Hype train %s: level %d\n", e.Type, e.Level)
+	case twitch.PollEvent:
+		fmt.Printf("Poll %s: %s\n", e.Type, e.Title)
+	}
+}
+
+// asks a yes/no question on the terminal
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 var kappas = []string{"Kappa", "KappaPride", "KappaClaus", "KappaRoss", "KappaWealth", "Keepo", "DarkMode"}
 
 func isKappa(str string) bool {
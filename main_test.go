@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tcode92/twitch-bot/cmd/bot"
+	"github.com/tcode92/twitch-bot/cmd/twitch"
+)
+
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("offline")
+}
+
+// the recorded session runs !uptime, a registered command would call helix
+// and reply
+func TestReplaySkipsCommands(t *testing.T) {
+	env := &bot.Env{
+		UserName:   "testbot",
+		Channels:   []string{"streamer"},
+		Commands:   []string{"stream", "moderation"},
+		ReplayPath: "cmd/bot/testdata/session.txt",
+	}
+	api := twitch.New(env)
+	// a command that slipped through fails without reaching twitch
+	api.SetHttpClient(&http.Client{Transport: offlineTransport{}})
+	b := bot.New(env)
+	if err := registerCommands(b, &api, env); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	sent := []string{}
+	r := bot.NewReplayer(env.ReplayPath, false)
+	r.OnSend = func(line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, line)
+	}
+	b.Transport = r
+	select {
+	case <-b.Connect():
+	case <-time.After(15 * time.Second):
+		t.Fatal("replay did not finish")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, line := range sent {
+		if strings.Contains(line, "PRIVMSG ") {
+			t.Fatalf("command replied during replay: %q", line)
+		}
+	}
+}
+
+func TestRegisterCommandsUnknownGroup(t *testing.T) {
+	env := &bot.Env{Commands: []string{"stream", "trivia"}}
+	api := twitch.New(env)
+	if err := registerCommands(bot.New(env), &api, env); err == nil {
+		t.Fatal("unknown command group accepted")
+	}
+}
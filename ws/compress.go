@@ -0,0 +1,255 @@
+package ws
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const deflateExtension = "permessage-deflate"
+
+// the deflate window is 32KB, context takeover keeps at most that much history
+const maxDeflateWindow = 1 << 15
+
+// sync flush marker removed from every compressed message (RFC 7692 7.2.1)
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// appended after the tail so the inflater sees a final empty block and returns EOF
+var deflateFinal = []byte{0x01, 0x00, 0x00, 0xff, 0xff}
+
+// permessage-deflate (RFC 7692) settings negotiated in the handshake
+type CompressionOptions struct {
+	// the server resets its compression context after every message
+	ServerNoContextTakeover bool
+	// the client resets its compression context after every message
+	ClientNoContextTakeover bool
+	// clients ask the server to use a smaller LZ77 window (8-15), 0 lets the server decide
+	ServerMaxWindowBits int
+	// compression level for outgoing messages, 0 uses flate.DefaultCompression
+	Level int
+	// outgoing messages smaller than this are sent uncompressed
+	MinSize int
+}
+
+// builds the Sec-WebSocket-Extensions offer for the handshake request
+func (o *CompressionOptions) offer() string {
+	params := []string{deflateExtension}
+	if o.ServerNoContextTakeover {
+		params = append(params, "server_no_context_takeover")
+	}
+	if o.ClientNoContextTakeover {
+		params = append(params, "client_no_context_takeover")
+	}
+	if o.ServerMaxWindowBits != 0 {
+		params = append(params, fmt.Sprintf("server_max_window_bits=%d", o.ServerMaxWindowBits))
+	}
+	return strings.Join(params, "; ")
+}
+
+// negotiated permessage-deflate state of a connection
+type deflateState struct {
+	// the peer resets its context after every message
+	readNoContextTakeover bool
+	// we reset our context after every message
+	writeNoContextTakeover bool
+	level                  int
+	minSize                int
+
+	// outgoing
+	fw   *flate.Writer
+	wbuf bytes.Buffer
+
+	// incoming
+	fr   io.ReadCloser
+	dict []byte
+}
+
+func newDeflateState(opts *CompressionOptions) *deflateState {
+	d := &deflateState{
+		level:   opts.Level,
+		minSize: opts.MinSize,
+	}
+	if d.level == 0 {
+		d.level = flate.DefaultCompression
+	}
+	return d
+}
+
+// parse the Sec-WebSocket-Extensions values accepted by the server
+//
+// returns nil if the server did not accept compression
+func parseDeflateExtension(values []string, opts *CompressionOptions) (*deflateState, error) {
+	var d *deflateState
+	for _, value := range values {
+		for _, ext := range strings.Split(value, ",") {
+			params := strings.Split(ext, ";")
+			name := strings.TrimSpace(params[0])
+			if name == "" {
+				continue
+			}
+			if name != deflateExtension || opts == nil {
+				return nil, fmt.Errorf("server accepted an extension that was not offered: %s", name)
+			}
+			if d != nil {
+				return nil, errors.New("server accepted permessage-deflate more than once")
+			}
+			d = newDeflateState(opts)
+			d.writeNoContextTakeover = opts.ClientNoContextTakeover
+			for _, p := range params[1:] {
+				key, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+				value = strings.Trim(strings.TrimSpace(value), `"`)
+				switch strings.TrimSpace(key) {
+				case "server_no_context_takeover":
+					d.readNoContextTakeover = true
+				case "client_no_context_takeover":
+					d.writeNoContextTakeover = true
+				case "server_max_window_bits":
+					// any window up to 15 bits can be inflated
+					bits, err := strconv.Atoi(value)
+					if err != nil || bits < 8 || bits > 15 {
+						return nil, fmt.Errorf("invalid server_max_window_bits: %q", value)
+					}
+				case "client_max_window_bits":
+					// not offered, the server may only echo the default window
+					if value != "" && value != "15" {
+						return nil, fmt.Errorf("unsupported client_max_window_bits: %q", value)
+					}
+				default:
+					return nil, fmt.Errorf("unknown permessage-deflate parameter: %q", key)
+				}
+			}
+		}
+	}
+	return d, nil
+}
+
+// picks the first permessage-deflate offer of a client that can be honored
+//
+// returns nil and an empty response if no offer is acceptable
+func acceptDeflateExtension(values []string, opts *CompressionOptions) (*deflateState, string) {
+	for _, value := range values {
+	offers:
+		for _, ext := range strings.Split(value, ",") {
+			params := strings.Split(ext, ";")
+			if strings.TrimSpace(params[0]) != deflateExtension {
+				continue
+			}
+			d := newDeflateState(opts)
+			d.writeNoContextTakeover = opts.ServerNoContextTakeover
+			d.readNoContextTakeover = opts.ClientNoContextTakeover
+			for _, p := range params[1:] {
+				key, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+				value = strings.Trim(strings.TrimSpace(value), `"`)
+				switch strings.TrimSpace(key) {
+				case "server_no_context_takeover":
+					d.writeNoContextTakeover = true
+				case "client_no_context_takeover":
+					d.readNoContextTakeover = true
+				case "server_max_window_bits":
+					// compress/flate always uses the full window
+					if value != "15" {
+						continue offers
+					}
+				case "client_max_window_bits":
+					// any window up to 15 bits can be inflated
+				default:
+					continue offers
+				}
+			}
+			response := []string{deflateExtension}
+			if d.writeNoContextTakeover {
+				response = append(response, "server_no_context_takeover")
+			}
+			if d.readNoContextTakeover {
+				response = append(response, "client_no_context_takeover")
+			}
+			return d, strings.Join(response, "; ")
+		}
+	}
+	return nil, ""
+}
+
+// prepares the compressor for a new message
+func (d *deflateState) resetWriter() error {
+	d.wbuf.Reset()
+	if d.fw == nil {
+		fw, err := flate.NewWriter(&d.wbuf, d.level)
+		if err != nil {
+			return err
+		}
+		d.fw = fw
+	} else if d.writeNoContextTakeover {
+		d.fw.Reset(&d.wbuf)
+	}
+	return nil
+}
+
+// compresses p and returns the output that can already be sent
+//
+// the last 4 bytes are held back since they may be the flush tail.
+// the returned slice is only valid until the next call
+func (d *deflateState) write(p []byte) ([]byte, error) {
+	if _, err := d.fw.Write(p); err != nil {
+		return nil, err
+	}
+	if d.wbuf.Len() <= len(deflateTail) {
+		return nil, nil
+	}
+	return d.wbuf.Next(d.wbuf.Len() - len(deflateTail)), nil
+}
+
+// ends the message and returns the remaining output without the tail
+func (d *deflateState) flush() ([]byte, error) {
+	if err := d.fw.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(d.wbuf.Bytes(), deflateTail), nil
+}
+
+// compress a whole message payload
+//
+// the returned slice is only valid until the next call
+func (d *deflateState) compress(p []byte) ([]byte, error) {
+	if err := d.resetWriter(); err != nil {
+		return nil, err
+	}
+	if _, err := d.fw.Write(p); err != nil {
+		return nil, err
+	}
+	return d.flush()
+}
+
+// returns a reader inflating the compressed message read from r
+func (d *deflateState) newReader(r io.Reader) (io.Reader, error) {
+	src := io.MultiReader(r, bytes.NewReader(deflateTail), bytes.NewReader(deflateFinal))
+	if d.fr == nil {
+		d.fr = flate.NewReaderDict(src, d.dict)
+	} else if err := d.fr.(flate.Resetter).Reset(src, d.dict); err != nil {
+		return nil, err
+	}
+	return inflateReader{d}, nil
+}
+
+// reads from the inflater keeping the dictionary for context takeover
+type inflateReader struct {
+	d *deflateState
+}
+
+func (r inflateReader) Read(p []byte) (int, error) {
+	n, err := r.d.fr.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("error inflating message: %w", err)
+	}
+	if n > 0 && !r.d.readNoContextTakeover {
+		// keep the last window of output as dictionary for the next message
+		r.d.dict = append(r.d.dict, p[:n]...)
+		if len(r.d.dict) > maxDeflateWindow {
+			r.d.dict = append(r.d.dict[:0], r.d.dict[len(r.d.dict)-maxDeflateWindow:]...)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,160 @@
+package ws
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDeflateExtension(t *testing.T) {
+	opts := &CompressionOptions{}
+	tests := []struct {
+		name    string
+		values  []string
+		opts    *CompressionOptions
+		wantErr bool
+		accept  bool
+	}{
+		{"not accepted", nil, opts, false, false},
+		{"accepted", []string{"permessage-deflate"}, opts, false, true},
+		{"with parameters", []string{"permessage-deflate; server_no_context_takeover; client_no_context_takeover; server_max_window_bits=10"}, opts, false, true},
+		{"not offered", []string{"permessage-deflate"}, nil, true, false},
+		{"unknown extension", []string{"x-webkit-deflate-frame"}, opts, true, false},
+		{"accepted twice", []string{"permessage-deflate, permessage-deflate"}, opts, true, false},
+		{"unknown parameter", []string{"permessage-deflate; foo"}, opts, true, false},
+		{"invalid window", []string{"permessage-deflate; server_max_window_bits=7"}, opts, true, false},
+		{"small client window", []string{"permessage-deflate; client_max_window_bits=9"}, opts, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := parseDeflateExtension(tt.values, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if (d != nil) != tt.accept {
+				t.Fatalf("unexpected state %v", d)
+			}
+		})
+	}
+}
+
+func TestAcceptDeflateExtension(t *testing.T) {
+	opts := &CompressionOptions{}
+	if d, _ := acceptDeflateExtension([]string{"permessage-deflate; server_max_window_bits=10"}, opts); d != nil {
+		t.Fatal("accepted a window compress/flate can't honor")
+	}
+	d, response := acceptDeflateExtension([]string{"permessage-deflate; server_max_window_bits=10, permessage-deflate; client_no_context_takeover"}, opts)
+	if d == nil || response != "permessage-deflate; client_no_context_takeover" {
+		t.Fatalf("unexpected response %q", response)
+	}
+}
+
+func TestCompressedEcho(t *testing.T) {
+	settings := []*CompressionOptions{
+		{},
+		{ServerNoContextTakeover: true, ClientNoContextTakeover: true},
+		{MinSize: 64},
+	}
+	for _, opts := range settings {
+		up := &Upgrader{Compression: opts}
+		up.OnConnect = func(c *Conn) {
+			c.OnTextMessage = func(message string) {
+				c.SendText(message)
+			}
+		}
+		s := httptest.NewServer(up)
+
+		c, _ := NewClient(strings.Replace(s.URL, "http", "ws", 1))
+		c.Compression = opts
+		received := make(chan string, 1)
+		c.OnTextMessage = func(message string) {
+			received <- message
+		}
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		if c.deflate == nil {
+			t.Fatal("compression not negotiated")
+		}
+		// repeated messages exercise the context takeover
+		for i := 0; i < 5; i++ {
+			message := strings.Repeat("Kappa PogChamp ", i*500+1)
+			if err := c.SendText(message); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case m := <-received:
+				if m != message {
+					t.Fatalf("message %d corrupted", i)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("echo not received")
+			}
+		}
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestCompressedStreaming(t *testing.T) {
+	up := &Upgrader{Compression: &CompressionOptions{}}
+	up.OnConnect = func(c *Conn) {
+		c.OnTextMessage = func(message string) {
+			w, _ := c.NextWriter(TextOpcode)
+			for _, part := range strings.SplitAfter(message, " ") {
+				io.WriteString(w, part)
+			}
+			w.Close()
+		}
+	}
+	s := httptest.NewServer(up)
+	defer s.Close()
+
+	c, _ := NewClient(strings.Replace(s.URL, "http", "ws", 1))
+	c.Compression = &CompressionOptions{}
+	c.ManualRead = true
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	message := strings.Repeat("LUL ", 20000)
+	if err := c.SendText(message); err != nil {
+		t.Fatal(err)
+	}
+	_, r, err := c.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil || string(b) != message {
+		t.Fatalf("streamed message corrupted: %d bytes, %v", len(b), err)
+	}
+}
+
+func TestCompressedMessageLimit(t *testing.T) {
+	up := &Upgrader{Compression: &CompressionOptions{}}
+	closed := make(chan struct{})
+	up.OnConnect = func(c *Conn) {
+		c.MaxMessageSize = 1000
+		c.OnDisconnect = func() {
+			close(closed)
+		}
+	}
+	s := httptest.NewServer(up)
+	defer s.Close()
+
+	c, _ := NewClient(strings.Replace(s.URL, "http", "ws", 1))
+	c.Compression = &CompressionOptions{}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	// a few bytes on the wire, far more once inflated
+	c.SendText(strings.Repeat("a", 100000))
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("decompression bomb not rejected")
+	}
+}
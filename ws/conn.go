@@ -0,0 +1,398 @@
+package ws
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// close status codes (RFC 6455 7.4.1)
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// time given to the peer to answer a close frame before the tcp connection is dropped
+const closeTimeout = 5 * time.Second
+
+// default read limits, a peer exceeding them is closed with 1009
+const DefaultMaxFrameSize = 1 << 20
+const DefaultMaxMessageSize = 4 << 20
+
+// CloseError reports the close frame that ended a connection
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket closed: %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Text)
+}
+
+// returns a protocol violation that closes the connection with 1002
+func protocolError(text string) *CloseError {
+	return &CloseError{Code: CloseProtocolError, Text: text}
+}
+
+// Conn is an established websocket connection, client or server side
+type Conn struct {
+	OnTextMessage   func(message string)
+	OnBinaryMessage func(message []byte)
+	OnPing          func()
+	OnPong          func()
+	OnDisconnect    func()
+	// largest frame payload accepted, 0 uses DefaultMaxFrameSize
+	MaxFrameSize int64
+	// largest reassembled (and inflated) message accepted, 0 uses DefaultMaxMessageSize
+	MaxMessageSize int64
+	conn           net.Conn
+	br             *bufio.Reader
+	// server connections send unmasked frames and require masked ones
+	isServer    bool
+	subprotocol string
+	// negotiated compression, nil if the peer did not accept it
+	deflate *deflateState
+	// serializes whole messages and the compression context
+	mmu sync.Mutex
+	// serializes frame writes
+	wmu       sync.Mutex
+	closeSent bool
+	// drops the connection if the peer never answers the close frame
+	closeTimer *time.Timer
+	// message being read and the error that ended reading
+	body    *messageBody
+	readErr error
+	// closed when the tcp connection is closed
+	done   chan struct{}
+	closed bool
+}
+
+// prepare the connection after a successful handshake
+func (c *Conn) init(conn net.Conn, br *bufio.Reader, isServer bool) {
+	c.conn = conn
+	c.br = br
+	c.isServer = isServer
+	c.closeSent = false
+	c.closeTimer = nil
+	c.body = nil
+	c.readErr = nil
+	c.closed = false
+	c.done = make(chan struct{})
+}
+
+// returns the subprotocol selected during the handshake, empty if none
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// returns a channel closed once the tcp connection is closed
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// starts the close handshake with a normal closure
+func (c *Conn) Close() {
+	c.CloseWithCode(CloseNormalClosure, "")
+}
+
+// starts the close handshake with the given status code and reason
+//
+// the tcp connection is closed when the peer answers or after a timeout
+func (c *Conn) CloseWithCode(code int, reason string) error {
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	c.wmu.Lock()
+	if c.closeSent {
+		c.wmu.Unlock()
+		return nil
+	}
+	err := c.writeFrame(true, false, CloseOpcode, closePayload(code, reason))
+	c.closeSent = true
+	// the client may reconnect before the timer fires, only drop this connection
+	conn := c.conn
+	c.closeTimer = time.AfterFunc(closeTimeout, func() {
+		conn.Close()
+	})
+	c.wmu.Unlock()
+	return err
+}
+
+// Send Text message
+func (c *Conn) SendText(t string) error {
+	return c.send([]byte(t), TextOpcode)
+}
+
+// Send raw bytes
+func (c *Conn) SendBytes(b []byte) error {
+	return c.send(b, BinaryOpcode)
+}
+
+// Send JSON payload
+//
+// Marshal the interface and sends it as text message
+func (c *Conn) SendJson(data interface{ any }) error {
+	// marshal json and send the message
+	var j []byte
+	j, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return c.send(j, TextOpcode)
+}
+
+// Send JSON payload
+//
+// Marshal the interface and sends it as binary message
+func (c *Conn) SendJsonBin(data interface{ any }) error {
+	// marshal json and send the message
+	var j []byte
+	j, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return c.send(j, BinaryOpcode)
+}
+
+// Ping message with "Ping" payload
+func (c *Conn) SendPing() error {
+	return c.writeControl(PingOpcode, []byte("Ping"))
+}
+
+// Pong message with "Pong" payload
+func (c *Conn) SendPong() error {
+	return c.writeControl(PongOpcode, []byte("Pong"))
+}
+
+// send the byte in the given opcode
+//
+// the payload is compressed when permessage-deflate was negotiated
+func (c *Conn) send(b []byte, opcode byte) error {
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	c.mmu.Lock()
+	defer c.mmu.Unlock()
+	compressed := false
+	if c.deflate != nil && len(b) >= c.deflate.minSize {
+		p, err := c.deflate.compress(b)
+		if err != nil {
+			return err
+		}
+		b = p
+		compressed = true
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return errors.New("connection is closing")
+	}
+	return c.writeFrame(true, compressed, opcode, b)
+}
+
+// writes a control frame, control frames may be sent in between fragments
+func (c *Conn) writeControl(opcode byte, payload []byte) error {
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return errors.New("connection is closing")
+	}
+	return c.writeFrame(true, false, opcode, payload)
+}
+
+// writes a single frame to the connection, masked on the client side
+//
+// caller must hold wmu
+func (c *Conn) writeFrame(fin bool, rsv1 bool, opcode byte, b []byte) error {
+	payloadLen := len(b)
+	payloadStart := 0
+
+	// determin header size based on payload
+	if payloadLen < 126 {
+		payloadStart = 2
+	} else if payloadLen <= 0xFFFF {
+		payloadStart = 4
+	} else {
+		payloadStart = 10
+	}
+	if !c.isServer {
+		// room for the mask
+		payloadStart += 4
+	}
+	payload := make([]byte, payloadStart+payloadLen)
+
+	// write first byte fin+rsv1+opcode
+	payload[0] = opcode
+	if fin {
+		payload[0] |= 0b10000000
+	}
+	if rsv1 {
+		payload[0] |= 0b01000000
+	}
+
+	// set payload length
+	if payloadLen < 126 {
+		payload[1] = byte(payloadLen)
+	} else if payloadLen <= 0xFFFF {
+		payload[1] = 126
+		binary.BigEndian.PutUint16(payload[2:4], uint16(payloadLen))
+	} else {
+		payload[1] = 127
+		binary.BigEndian.PutUint64(payload[2:10], uint64(payloadLen))
+	}
+
+	if c.isServer {
+		copy(payload[payloadStart:], b)
+	} else {
+		// mask must be set from the client
+		payload[1] |= 0b10000000
+		mask := getMaskKey()
+		copy(payload[payloadStart-4:payloadStart], mask)
+		// mask the payload and write it
+		for i, data := range b {
+			payload[payloadStart+i] = data ^ mask[i%4]
+		}
+	}
+	// write the frame to the connection
+	_, err := c.conn.Write(payload)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// answers a close frame received from the peer
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	if len(payload) == 1 {
+		return c.fail(protocolError("invalid close payload"))
+	}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return c.fail(protocolError("invalid close code"))
+		}
+		if !utf8.ValidString(closeErr.Text) {
+			return c.fail(&CloseError{Code: CloseInvalidFramePayloadData, Text: "invalid utf-8 close reason"})
+		}
+	}
+	// echo the status code if we didn't start the close handshake
+	c.wmu.Lock()
+	if !c.closeSent {
+		code := closeErr.Code
+		if code == CloseNoStatusReceived {
+			code = CloseNormalClosure
+		}
+		c.writeFrame(true, false, CloseOpcode, closePayload(code, ""))
+		c.closeSent = true
+	}
+	c.wmu.Unlock()
+	return closeErr
+}
+
+// fails the connection sending a close frame if err is a protocol error
+func (c *Conn) fail(err error) error {
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) {
+		c.wmu.Lock()
+		if !c.closeSent {
+			c.writeFrame(true, false, CloseOpcode, closePayload(closeErr.Code, closeErr.Text))
+			c.closeSent = true
+		}
+		c.wmu.Unlock()
+		return err
+	}
+	if err == io.EOF || errors.Is(err, net.ErrClosed) {
+		// the tcp connection was closed without a close frame
+		return &CloseError{Code: CloseAbnormalClosure}
+	}
+	return err
+}
+
+// closes the tcp connection and notify the disconnection once
+func (c *Conn) finish() {
+	c.wmu.Lock()
+	if c.closed {
+		c.wmu.Unlock()
+		return
+	}
+	c.closed = true
+	if c.closeTimer != nil {
+		c.closeTimer.Stop()
+	}
+	c.wmu.Unlock()
+	c.conn.Close()
+	close(c.done)
+	if c.OnDisconnect != nil {
+		c.OnDisconnect()
+	}
+}
+
+func (c *Conn) maxFrameSize() int64 {
+	if c.MaxFrameSize > 0 {
+		return c.MaxFrameSize
+	}
+	return DefaultMaxFrameSize
+}
+
+func (c *Conn) maxMessageSize() int64 {
+	if c.MaxMessageSize > 0 {
+		return c.MaxMessageSize
+	}
+	return DefaultMaxMessageSize
+}
+
+// builds the payload of a close frame
+func closePayload(code int, reason string) []byte {
+	if code == CloseNoStatusReceived {
+		return nil
+	}
+	// the payload of a control frame is limited to 125 bytes
+	if len(reason) > 123 {
+		// a cut rune would make the reason invalid utf-8
+		n := 123
+		for n > 0 && !utf8.RuneStart(reason[n]) {
+			n--
+		}
+		reason = reason[:n]
+	}
+	p := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(p, uint16(code))
+	return append(p, reason...)
+}
+
+// reports whether code can be sent in a close frame
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,563 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// raw side of a connection under test, frames are written and read byte by byte
+type testPeer struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+	// the peer is a client and masks its frames
+	masked bool
+}
+
+// a frame written by the peer, first is the fin/rsv/opcode byte
+type testFrame struct {
+	first   byte
+	payload string
+}
+
+// connects a Conn and a raw peer over localhost
+func newTestPair(t *testing.T, isServer bool) (*Conn, *testPeer) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		accepted <- conn
+	}()
+	a, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := <-accepted
+	if b == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	a.SetDeadline(time.Now().Add(5 * time.Second))
+	b.SetDeadline(time.Now().Add(5 * time.Second))
+
+	c := &Conn{}
+	c.init(a, bufio.NewReader(a), isServer)
+	return c, &testPeer{t: t, conn: b, br: bufio.NewReader(b), masked: isServer}
+}
+
+// starts the callback loop and collects the messages
+func runConn(c *Conn) (chan string, chan []byte) {
+	text := make(chan string, 16)
+	binary := make(chan []byte, 16)
+	c.OnTextMessage = func(message string) {
+		text <- message
+	}
+	c.OnBinaryMessage = func(message []byte) {
+		binary <- message
+	}
+	go c.Run()
+	return text, binary
+}
+
+func (p *testPeer) writeFrame(first byte, payload []byte) {
+	p.t.Helper()
+	var frame []byte
+	frame = append(frame, first)
+	var maskBit byte
+	if p.masked {
+		maskBit = 0b10000000
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	payload = bytes.Clone(payload)
+	if p.masked {
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		frame = append(frame, mask...)
+		maskBytes(mask, 0, payload)
+	}
+	frame = append(frame, payload...)
+	if _, err := p.conn.Write(frame); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func (p *testPeer) writeFrames(frames []testFrame) {
+	p.t.Helper()
+	for _, f := range frames {
+		p.writeFrame(f.first, []byte(f.payload))
+	}
+}
+
+// reads a frame sent by the Conn and checks its encoding
+func (p *testPeer) readFrame() (byte, []byte) {
+	p.t.Helper()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(p.br, header); err != nil {
+		p.t.Fatal(err)
+	}
+	masked := header[1]&0b10000000 != 0
+	if masked == p.masked {
+		p.t.Fatalf("unexpected mask bit %v", masked)
+	}
+	length := uint64(header[1] & 0b01111111)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		io.ReadFull(p.br, ext)
+		length = uint64(binary.BigEndian.Uint16(ext))
+		if length < 126 {
+			p.t.Fatalf("length %d not minimally encoded", length)
+		}
+	case 127:
+		ext := make([]byte, 8)
+		io.ReadFull(p.br, ext)
+		length = binary.BigEndian.Uint64(ext)
+		if length <= 0xFFFF {
+			p.t.Fatalf("length %d not minimally encoded", length)
+		}
+	}
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		io.ReadFull(p.br, mask)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(p.br, payload); err != nil {
+		p.t.Fatal(err)
+	}
+	maskBytes(mask, 0, payload)
+	return header[0], payload
+}
+
+// expects a close frame with the given code, skipping other frames
+func (p *testPeer) expectClose(code int) string {
+	p.t.Helper()
+	for {
+		first, payload := p.readFrame()
+		if first&0x0F != CloseOpcode {
+			continue
+		}
+		if first&0b10000000 == 0 {
+			p.t.Fatal("close frame without fin")
+		}
+		got := CloseNoStatusReceived
+		if len(payload) >= 2 {
+			got = int(binary.BigEndian.Uint16(payload))
+		}
+		if got != code {
+			p.t.Fatalf("expected close %d, got %d (%q)", code, got, payload)
+		}
+		return string(payload[min(2, len(payload)):])
+	}
+}
+
+func expectDone(t *testing.T, c *Conn) {
+	t.Helper()
+	select {
+	case <-c.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection not closed")
+	}
+}
+
+// close frame with any code, even the ones that can't be sent
+func closeFrame(code int, reason string) testFrame {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return testFrame{0x88, string(payload) + reason}
+}
+
+func TestFrameLengths(t *testing.T) {
+	for _, size := range []int{0, 1, 125, 126, 127, 0xFFFF, 0x10000, 300000} {
+		c, peer := newTestPair(t, false)
+		text, _ := runConn(c)
+		message := strings.Repeat("*", size)
+
+		peer.writeFrame(0x81, []byte(message))
+		select {
+		case m := <-text:
+			if m != message {
+				t.Fatalf("size %d: received %d bytes", size, len(m))
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("size %d: message not received", size)
+		}
+
+		go c.SendText(message)
+		first, payload := peer.readFrame()
+		if first != 0x81 {
+			t.Fatalf("size %d: unexpected first byte %#x", size, first)
+		}
+		if string(payload) != message {
+			t.Fatalf("size %d: sent %d bytes", size, len(payload))
+		}
+	}
+}
+
+func TestBinaryMessage(t *testing.T) {
+	c, peer := newTestPair(t, false)
+	_, bin := runConn(c)
+	message := []byte{0x00, 0xff, 0x10, 0x80}
+	peer.writeFrame(0x82, message)
+	if m := <-bin; !bytes.Equal(m, message) {
+		t.Fatalf("received %v", m)
+	}
+	go c.SendBytes(message)
+	first, payload := peer.readFrame()
+	if first != 0x82 || !bytes.Equal(payload, message) {
+		t.Fatalf("sent %#x %v", first, payload)
+	}
+}
+
+func TestFragmentation(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []testFrame
+		want   string
+	}{
+		{"two fragments", []testFrame{{0x01, "frag"}, {0x80, "ment"}}, "fragment"},
+		{"empty fragments", []testFrame{{0x01, ""}, {0x00, ""}, {0x80, ""}}, ""},
+		{"many fragments", []testFrame{{0x01, "a"}, {0x00, "b"}, {0x00, "c"}, {0x80, "d"}}, "abcd"},
+		{"ping in between", []testFrame{{0x01, "fr"}, {0x89, "ping"}, {0x80, "ag"}}, "frag"},
+		{"pong in between", []testFrame{{0x01, "fr"}, {0x8A, ""}, {0x80, "ag"}}, "frag"},
+		{"rune split across fragments", []testFrame{{0x01, "\xce"}, {0x80, "\xba"}}, "κ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, peer := newTestPair(t, false)
+			text, _ := runConn(c)
+			peer.writeFrames(tt.frames)
+			select {
+			case m := <-text:
+				if m != tt.want {
+					t.Fatalf("received %q", m)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("message not received")
+			}
+		})
+	}
+}
+
+func TestPingIsAnswered(t *testing.T) {
+	c, peer := newTestPair(t, false)
+	pinged := make(chan bool, 1)
+	c.OnPing = func() {
+		pinged <- true
+	}
+	runConn(c)
+	peer.writeFrame(0x89, []byte("payload"))
+	first, payload := peer.readFrame()
+	if first != 0x8A || string(payload) != "payload" {
+		t.Fatalf("unexpected pong %#x %q", first, payload)
+	}
+	<-pinged
+}
+
+// protocol violations sent by the server must close the connection with the right code
+func TestProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []testFrame
+		code   int
+	}{
+		{"rsv2 set", []testFrame{{0xA1, "a"}}, CloseProtocolError},
+		{"rsv3 set", []testFrame{{0x91, "a"}}, CloseProtocolError},
+		{"rsv1 without compression", []testFrame{{0xC1, "a"}}, CloseProtocolError},
+		{"reserved data opcode", []testFrame{{0x83, ""}}, CloseProtocolError},
+		{"reserved control opcode", []testFrame{{0x8B, ""}}, CloseProtocolError},
+		{"continuation without start", []testFrame{{0x80, "a"}}, CloseProtocolError},
+		{"text while fragmented", []testFrame{{0x01, "a"}, {0x81, "b"}}, CloseProtocolError},
+		{"fragmented ping", []testFrame{{0x09, "a"}, {0x80, "b"}}, CloseProtocolError},
+		{"ping too long", []testFrame{{0x89, strings.Repeat("a", 126)}}, CloseProtocolError},
+		{"close too long", []testFrame{{0x88, "\x03\xe8" + strings.Repeat("a", 124)}}, CloseProtocolError},
+		{"invalid utf-8", []testFrame{{0x81, "\xce\xba\xff"}}, CloseInvalidFramePayloadData},
+		{"invalid utf-8 fragment", []testFrame{{0x01, "ok"}, {0x80, "\xed\xa0\x80"}}, CloseInvalidFramePayloadData},
+		{"truncated utf-8", []testFrame{{0x81, "\xce"}}, CloseInvalidFramePayloadData},
+		{"close payload of one byte", []testFrame{{0x88, "\x03"}}, CloseProtocolError},
+		{"close code 999", []testFrame{closeFrame(999, "")}, CloseProtocolError},
+		{"close code 1005", []testFrame{closeFrame(1005, "")}, CloseProtocolError},
+		{"close code 1006", []testFrame{closeFrame(1006, "")}, CloseProtocolError},
+		{"close code 1015", []testFrame{closeFrame(1015, "")}, CloseProtocolError},
+		{"close code 5000", []testFrame{closeFrame(5000, "")}, CloseProtocolError},
+		{"close invalid utf-8 reason", []testFrame{{0x88, "\x03\xe8\xff"}}, CloseInvalidFramePayloadData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, peer := newTestPair(t, false)
+			runConn(c)
+			peer.writeFrames(tt.frames)
+			peer.expectClose(tt.code)
+			expectDone(t, c)
+		})
+	}
+}
+
+func TestMaskedFrameFromServer(t *testing.T) {
+	c, peer := newTestPair(t, false)
+	runConn(c)
+	// a client peer masks its frames, the server is not allowed to
+	peer.masked = true
+	peer.writeFrame(0x81, []byte("masked"))
+	peer.masked = false
+	peer.expectClose(CloseProtocolError)
+}
+
+func TestServerConnMasking(t *testing.T) {
+	c, peer := newTestPair(t, true)
+	text, _ := runConn(c)
+	peer.writeFrame(0x81, []byte("masked"))
+	if m := <-text; m != "masked" {
+		t.Fatalf("received %q", m)
+	}
+	go c.SendText("unmasked")
+	if _, payload := peer.readFrame(); string(payload) != "unmasked" {
+		t.Fatalf("sent %q", payload)
+	}
+
+	// unmasked client frames are rejected
+	peer.masked = false
+	peer.writeFrame(0x81, []byte("unmasked"))
+	peer.masked = true
+	peer.expectClose(CloseProtocolError)
+}
+
+func TestCloseHandshake(t *testing.T) {
+	t.Run("echo peer close", func(t *testing.T) {
+		c, peer := newTestPair(t, false)
+		disconnected := make(chan bool, 1)
+		c.OnDisconnect = func() {
+			disconnected <- true
+		}
+		runConn(c)
+		peer.writeFrames([]testFrame{closeFrame(CloseGoingAway, "bye")})
+		peer.expectClose(CloseGoingAway)
+		expectDone(t, c)
+		<-disconnected
+	})
+	t.Run("empty close", func(t *testing.T) {
+		c, peer := newTestPair(t, false)
+		runConn(c)
+		peer.writeFrame(0x88, nil)
+		peer.expectClose(CloseNormalClosure)
+		expectDone(t, c)
+	})
+	t.Run("local close", func(t *testing.T) {
+		c, peer := newTestPair(t, false)
+		runConn(c)
+		go c.CloseWithCode(4000, "done")
+		if reason := peer.expectClose(4000); reason != "done" {
+			t.Fatalf("unexpected reason %q", reason)
+		}
+		if err := c.SendText("late"); err == nil {
+			t.Fatal("send after close should fail")
+		}
+		peer.writeFrames([]testFrame{closeFrame(4000, "")})
+		expectDone(t, c)
+	})
+	t.Run("long reason is cut on a rune boundary", func(t *testing.T) {
+		c, peer := newTestPair(t, false)
+		runConn(c)
+		go c.CloseWithCode(4000, strings.Repeat("é", 100))
+		reason := peer.expectClose(4000)
+		if len(reason) > 123 || !utf8.ValidString(reason) {
+			t.Fatalf("invalid reason of %d bytes %q", len(reason), reason)
+		}
+		peer.writeFrames([]testFrame{closeFrame(4000, "")})
+		expectDone(t, c)
+	})
+	t.Run("peer drops connection", func(t *testing.T) {
+		c, peer := newTestPair(t, false)
+		runConn(c)
+		peer.conn.Close()
+		expectDone(t, c)
+	})
+}
+
+func TestClientReconnect(t *testing.T) {
+	up := &Upgrader{}
+	up.OnConnect = func(c *Conn) {
+		c.OnTextMessage = func(message string) {
+			c.SendText(message)
+		}
+	}
+	s := httptest.NewServer(up)
+	defer s.Close()
+
+	c, _ := NewClient(strings.Replace(s.URL, "http", "ws", 1))
+	received := make(chan string, 1)
+	disconnected := make(chan bool, 1)
+	c.OnTextMessage = func(message string) {
+		received <- message
+	}
+	c.OnDisconnect = func() {
+		disconnected <- true
+	}
+	// the same client is connected again after every close
+	for i := 0; i < 3; i++ {
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		message := fmt.Sprintf("connection %d", i)
+		c.SendText(message)
+		select {
+		case m := <-received:
+			if m != message {
+				t.Fatalf("received %q", m)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("echo not received on connection %d", i)
+		}
+		c.Close()
+		select {
+		case <-disconnected:
+		case <-time.After(2 * time.Second):
+			t.Fatal("close handshake not completed")
+		}
+	}
+}
+
+func TestReadLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxFrame   int64
+		maxMessage int64
+		frames     []testFrame
+	}{
+		{"frame too big", 10, 100, []testFrame{{0x81, strings.Repeat("a", 11)}}},
+		{"message too big", 10, 10, []testFrame{{0x01, "123456"}, {0x80, "123456"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, peer := newTestPair(t, false)
+			c.MaxFrameSize = tt.maxFrame
+			c.MaxMessageSize = tt.maxMessage
+			runConn(c)
+			peer.writeFrames(tt.frames)
+			peer.expectClose(CloseMessageTooBig)
+			expectDone(t, c)
+		})
+	}
+
+	t.Run("huge declared length", func(t *testing.T) {
+		c, peer := newTestPair(t, false)
+		runConn(c)
+		// 1TB payload announced, nothing may be allocated for it
+		header := []byte{0x82, 127}
+		header = binary.BigEndian.AppendUint64(header, 1<<40)
+		peer.conn.Write(header)
+		peer.expectClose(CloseMessageTooBig)
+		expectDone(t, c)
+	})
+}
+
+func TestNextReader(t *testing.T) {
+	c, peer := newTestPair(t, false)
+	peer.writeFrames([]testFrame{{0x02, "str"}, {0x89, ""}, {0x80, "eam"}, {0x81, "next"}})
+
+	messageType, r, err := c.NextReader()
+	if err != nil || messageType != BinaryOpcode {
+		t.Fatalf("unexpected message %d %v", messageType, err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil || string(b) != "stream" {
+		t.Fatalf("read %q %v", b, err)
+	}
+	if first, _ := peer.readFrame(); first != 0x8A {
+		t.Fatalf("expected pong, got %#x", first)
+	}
+
+	messageType, r, err = c.NextReader()
+	if err != nil || messageType != TextOpcode {
+		t.Fatalf("unexpected message %d %v", messageType, err)
+	}
+	// leave the message unread, the next call discards it
+	peer.writeFrames([]testFrame{{0x81, "last"}})
+	_, r, err = c.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "last" {
+		t.Fatalf("read %q", b)
+	}
+
+	peer.writeFrames([]testFrame{closeFrame(CloseNormalClosure, "")})
+	_, _, err = c.NextReader()
+	if closeErr, ok := err.(*CloseError); !ok || closeErr.Code != CloseNormalClosure {
+		t.Fatalf("expected close error, got %v", err)
+	}
+}
+
+func TestNextWriter(t *testing.T) {
+	c, peer := newTestPair(t, false)
+	w, err := c.NextWriter(TextOpcode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		io.WriteString(w, "frag")
+		// control frames can be sent in the middle of a message
+		c.SendPing()
+		io.WriteString(w, "ment")
+		w.Close()
+	}()
+	want := []struct {
+		first   byte
+		payload string
+	}{{0x01, "frag"}, {0x89, "Ping"}, {0x00, "ment"}, {0x80, ""}}
+	for _, f := range want {
+		first, payload := peer.readFrame()
+		if first != f.first || string(payload) != f.payload {
+			t.Fatalf("expected %#x %q, got %#x %q", f.first, f.payload, first, payload)
+		}
+	}
+	if _, err := c.NextWriter(CloseOpcode); err == nil {
+		t.Fatal("control opcode accepted as message type")
+	}
+}
+
+func TestUtf8Validator(t *testing.T) {
+	text := "κόσμε 𝄞"
+	// every split of a valid text must be accepted
+	for i := 0; i <= len(text); i++ {
+		var v utf8Validator
+		if !v.valid([]byte(text[:i])) || !v.valid([]byte(text[i:])) || !v.complete() {
+			t.Fatalf("valid text rejected when split at %d", i)
+		}
+	}
+	var v utf8Validator
+	if !v.valid([]byte("\xf0\x9d")) || v.complete() {
+		t.Fatal("incomplete rune reported as complete")
+	}
+	if v.valid([]byte("a")) {
+		t.Fatal("broken rune accepted")
+	}
+}
@@ -0,0 +1,121 @@
+package ws
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Dialer opens the connection used by a Client
+type Dialer struct {
+	// dialer used to open tcp connections, a zero net.Dialer if nil
+	NetDialer *net.Dialer
+	// custom dial function, takes precedence over NetDialer
+	NetDial func(ctx context.Context, network string, addr string) (net.Conn, error)
+	// tls config for wss urls (root CAs, SNI, client certificates), cloned before use
+	TLSConfig *tls.Config
+	// maximum time for dial, proxy and websocket handshake, 0 means no timeout
+	HandshakeTimeout time.Duration
+	// returns the proxy to use for the given url, a nil url means direct connection
+	//
+	// http, https and socks5 proxies are supported
+	Proxy func(u *url.URL) (*url.URL, error)
+}
+
+// dialer used by clients without a Dialer
+var DefaultDialer = &Dialer{
+	HandshakeTimeout: 45 * time.Second,
+	Proxy:            ProxyFromEnvironment,
+}
+
+// opens the connection to the websocket server of u
+//
+// the connection goes through the proxy if any and is wrapped in tls for wss urls
+func (d *Dialer) dialContext(ctx context.Context, u *url.URL) (net.Conn, error) {
+	addr := hostPort(u)
+
+	var proxyUrl *url.URL
+	if d.Proxy != nil {
+		p, err := d.Proxy(u)
+		if err != nil {
+			return nil, err
+		}
+		proxyUrl = p
+	}
+
+	var conn net.Conn
+	var err error
+	if proxyUrl != nil {
+		conn, err = d.dialProxy(ctx, proxyUrl, addr)
+	} else {
+		conn, err = d.netDial(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "wss" {
+		cfg := &tls.Config{}
+		if d.TLSConfig != nil {
+			cfg = d.TLSConfig.Clone()
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+func (d *Dialer) netDial(ctx context.Context, network string, addr string) (net.Conn, error) {
+	if d.NetDial != nil {
+		return d.NetDial(ctx, network, addr)
+	}
+	nd := d.NetDialer
+	if nd == nil {
+		nd = &net.Dialer{}
+	}
+	return nd.DialContext(ctx, network, addr)
+}
+
+// runs fn with conn bound to ctx
+//
+// the deadline of ctx is applied to conn and a canceled ctx interrupts blocked reads and writes
+func withContext(ctx context.Context, conn net.Conn, fn func() error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		// a deadline in the past wakes up any blocked call
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	err := fn()
+	if !stop() {
+		return ctx.Err()
+	}
+	conn.SetDeadline(time.Time{})
+	return err
+}
+
+// returns host:port of u, adding the default port of the scheme
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "wss", "https":
+			port = "443"
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
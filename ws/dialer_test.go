@@ -0,0 +1,113 @@
+package ws
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// minimal http CONNECT proxy requiring basic auth
+func newConnectProxy(t *testing.T) *url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				req, err := http.ReadRequest(br)
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				if req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+					conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+					return
+				}
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+				go io.Copy(upstream, br)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return &url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+func TestDialThroughProxy(t *testing.T) {
+	up := &Upgrader{}
+	up.OnConnect = func(c *Conn) {
+		c.OnTextMessage = func(message string) {
+			c.SendText(message)
+		}
+	}
+	s := httptest.NewServer(up)
+	defer s.Close()
+	proxy := newConnectProxy(t)
+
+	c, _ := NewClient(strings.Replace(s.URL, "http", "ws", 1))
+	c.Dialer = &Dialer{Proxy: ProxyURL(proxy), HandshakeTimeout: time.Second}
+	if err := c.Connect(); err == nil {
+		t.Fatal("proxy without credentials accepted")
+	}
+
+	proxy.User = url.UserPassword("user", "pass")
+	received := make(chan string, 1)
+	c.OnTextMessage = func(message string) {
+		received <- message
+	}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SendText("through the proxy")
+	if m := <-received; m != "through the proxy" {
+		t.Fatalf("received %q", m)
+	}
+}
+
+func TestDialContextCancel(t *testing.T) {
+	// accepts the connection but never answers the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(io.Discard, conn)
+	}()
+
+	c, _ := NewClient("ws://" + l.Addr().String())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := c.ConnectContext(ctx); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("handshake not interrupted by the context")
+	}
+}
@@ -0,0 +1,170 @@
+package ws
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// performs the opening handshake on conn
+//
+// returns the reader positioned at the first frame sent by the server
+func (c *Client) handshake(conn net.Conn) (*bufio.Reader, error) {
+	webSecKey := genSecWebSocketKey()
+	req := c.newHandshakeRequest(webSecKey)
+
+	// send handshake request
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("error in http req: %w", err)
+	}
+
+	// read handshake response, the reader may buffer frames sent right after it
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("error reading handshake response: %w", err)
+	}
+	resp.Body.Close()
+
+	// validate accept key
+	acceptKey, err := getAcceptKeyFromHeaders(resp)
+	if err != nil {
+		return nil, err
+	}
+	if acceptKey != computeAcceptKey(webSecKey) {
+		return nil, errors.New("recived invalid accept key")
+	}
+
+	// check the subprotocol selected by the server
+	protocol := resp.Header.Get("Sec-WebSocket-Protocol")
+	if protocol != "" && !slices.Contains(c.Subprotocols, protocol) {
+		return nil, fmt.Errorf("server selected a subprotocol that was not offered: %s", protocol)
+	}
+
+	// check the extensions accepted by the server
+	deflate, err := parseDeflateExtension(resp.Header.Values("Sec-WebSocket-Extensions"), c.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Jar != nil {
+		if cookies := resp.Cookies(); len(cookies) > 0 {
+			c.Jar.SetCookies(httpUrl(c.url), cookies)
+		}
+	}
+	c.subprotocol = protocol
+	c.deflate = deflate
+	return br, nil
+}
+
+// builds the upgrade request with the custom headers of the client
+func (c *Client) newHandshakeRequest(webSecKey string) *http.Request {
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        c.url,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       c.url.Host,
+	}
+	for k, v := range c.Header {
+		if strings.EqualFold(k, "Host") && len(v) > 0 {
+			req.Host = v[0]
+			continue
+		}
+		req.Header[k] = v
+	}
+	if c.Jar != nil {
+		for _, cookie := range c.Jar.Cookies(httpUrl(c.url)) {
+			req.AddCookie(cookie)
+		}
+	}
+	// websocket headers can not be overridden by the custom ones
+	req.Header["Upgrade"] = []string{"websocket"}
+	req.Header["Connection"] = []string{"Upgrade"}
+	req.Header["Sec-WebSocket-Key"] = []string{webSecKey}
+	req.Header["Sec-WebSocket-Version"] = []string{"13"}
+	if len(c.Subprotocols) > 0 {
+		req.Header["Sec-WebSocket-Protocol"] = []string{strings.Join(c.Subprotocols, ", ")}
+	}
+	if c.Compression != nil {
+		req.Header["Sec-WebSocket-Extensions"] = []string{c.Compression.offer()}
+	}
+	return req
+}
+
+// generates a random websocket key for the handshake
+func genSecWebSocketKey() string {
+	key := make([]byte, 16)
+	_, err := rand.Read(key)
+	if err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func computeAcceptKey(key string) string {
+	const websocketMagic = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	h := sha1.New()
+	_, err := h.Write([]byte(string(key) + websocketMagic))
+	if err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// validate the handshake response
+//
+// return Sec-WebSocket-Accept header if the upgrade was accepted or error
+func getAcceptKeyFromHeaders(resp *http.Response) (string, error) {
+	if resp == nil {
+		return "", errors.New("invalid headers")
+	}
+	// check the response status is 101
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return "", fmt.Errorf("invalid status: expected 101 recived %d", resp.StatusCode)
+	}
+	if !headerContainsToken(resp.Header, "Upgrade", "websocket") {
+		return "", errors.New("invalid upgrade header: expected websocket")
+	}
+	if !headerContainsToken(resp.Header, "Connection", "upgrade") {
+		return "", errors.New("invalid connection header: expected upgrade")
+	}
+	secAcceptKey := strings.TrimSpace(resp.Header.Get("Sec-WebSocket-Accept"))
+	if secAcceptKey == "" {
+		return secAcceptKey, errors.New("sec-websocket-accept not found")
+	}
+	return secAcceptKey, nil
+}
+
+// reports whether the comma separated header contains token, case insensitive
+func headerContainsToken(h http.Header, name string, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cookie jars only know about http urls
+func httpUrl(u *url.URL) *url.URL {
+	h := *u
+	if h.Scheme == "wss" {
+		h.Scheme = "https"
+	} else {
+		h.Scheme = "http"
+	}
+	return &h
+}
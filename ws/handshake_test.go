@@ -0,0 +1,174 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestComputeAcceptKey(t *testing.T) {
+	// example from RFC 6455 section 1.3
+	if got := computeAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected accept key %q", got)
+	}
+	if computeAcceptKey("dGhlIHNhbXBsZSBub25jZQ==") == computeAcceptKey(genSecWebSocketKey()) {
+		t.Fatal("different keys produced the same accept key")
+	}
+}
+
+func TestGetAcceptKeyFromHeaders(t *testing.T) {
+	valid := func() *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusSwitchingProtocols,
+			Header: http.Header{
+				"Upgrade":              {"WebSocket"},
+				"Connection":           {"keep-alive, Upgrade"},
+				"Sec-Websocket-Accept": {" s3pPLMBiTxaQ9kYGzzhZRbK+xOo= "},
+			},
+		}
+	}
+	key, err := getAcceptKeyFromHeaders(valid())
+	if err != nil || key != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("valid response rejected: %q %v", key, err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(r *http.Response) *http.Response
+	}{
+		{"nil response", func(r *http.Response) *http.Response { return nil }},
+		{"status 200", func(r *http.Response) *http.Response { r.StatusCode = 200; return r }},
+		{"status 400", func(r *http.Response) *http.Response { r.StatusCode = 400; return r }},
+		{"missing upgrade", func(r *http.Response) *http.Response { r.Header.Del("Upgrade"); return r }},
+		{"wrong upgrade", func(r *http.Response) *http.Response { r.Header.Set("Upgrade", "h2c"); return r }},
+		{"missing connection", func(r *http.Response) *http.Response { r.Header.Del("Connection"); return r }},
+		{"wrong connection", func(r *http.Response) *http.Response { r.Header.Set("Connection", "close"); return r }},
+		{"missing accept", func(r *http.Response) *http.Response { r.Header.Del("Sec-WebSocket-Accept"); return r }},
+		{"empty accept", func(r *http.Response) *http.Response { r.Header.Set("Sec-WebSocket-Accept", " "); return r }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := getAcceptKeyFromHeaders(tt.modify(valid())); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+// server answering every request with a canned handshake response
+func newRawServer(t *testing.T, response func(key string) string) string {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte(response(r.Header.Get("Sec-WebSocket-Key"))))
+	}))
+	t.Cleanup(s.Close)
+	return strings.Replace(s.URL, "http", "ws", 1)
+}
+
+func TestClientHandshakeFailures(t *testing.T) {
+	upgrade := func(key string, extra string) string {
+		return "HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + computeAcceptKey(key) + "\r\n" +
+			extra + "\r\n"
+	}
+	tests := []struct {
+		name     string
+		response func(key string) string
+	}{
+		{"not an http response", func(string) string { return "garbage\r\n\r\n" }},
+		{"short status line", func(string) string { return "HTTP/1.1\r\n\r\n" }},
+		{"closed before headers", func(string) string { return "HTTP/1.1 101 Switching" }},
+		{"forbidden", func(string) string { return "HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\n\r\n" }},
+		{"wrong accept key", func(string) string { return upgrade("other", "") }},
+		{"subprotocol not offered", func(key string) string { return upgrade(key, "Sec-WebSocket-Protocol: chat\r\n") }},
+		{"extension not offered", func(key string) string { return upgrade(key, "Sec-WebSocket-Extensions: permessage-deflate\r\n") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(newRawServer(t, tt.response))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Connect(); err == nil {
+				t.Fatal("expected handshake error")
+			}
+		})
+	}
+}
+
+func TestClientHandshakeHeaders(t *testing.T) {
+	up := &Upgrader{
+		Subprotocols: []string{"irc", "chat"},
+		CheckOrigin: func(r *http.Request) bool {
+			return r.Header.Get("Origin") == "https://example.com" &&
+				r.Header.Get("Authorization") == "Bearer token" &&
+				r.Header.Get("User-Agent") == "twitch-bot"
+		},
+	}
+	s := httptest.NewServer(up)
+	defer s.Close()
+
+	c, _ := NewClient(strings.Replace(s.URL, "http", "ws", 1) + "/path?query=1")
+	c.Header = http.Header{
+		"Origin":        {"https://example.com"},
+		"Authorization": {"Bearer token"},
+		"User-Agent":    {"twitch-bot"},
+		// can't replace the websocket headers
+		"Upgrade": {"h2c"},
+	}
+	c.Subprotocols = []string{"chat", "irc"}
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Subprotocol() != "irc" {
+		t.Fatalf("unexpected subprotocol %q", c.Subprotocol())
+	}
+}
+
+func TestUpgraderRejects(t *testing.T) {
+	s := httptest.NewServer(&Upgrader{})
+	defer s.Close()
+	request := func(modify func(r *http.Request)) int {
+		r, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", genSecWebSocketKey())
+		modify(r)
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	tests := []struct {
+		name   string
+		modify func(r *http.Request)
+		status int
+	}{
+		{"valid", func(r *http.Request) {}, http.StatusSwitchingProtocols},
+		{"post", func(r *http.Request) { r.Method = http.MethodPost }, http.StatusMethodNotAllowed},
+		{"no upgrade", func(r *http.Request) { r.Header.Del("Upgrade") }, http.StatusBadRequest},
+		{"no connection upgrade", func(r *http.Request) { r.Header.Set("Connection", "keep-alive") }, http.StatusBadRequest},
+		{"old version", func(r *http.Request) { r.Header.Set("Sec-WebSocket-Version", "8") }, http.StatusUpgradeRequired},
+		{"short key", func(r *http.Request) { r.Header.Set("Sec-WebSocket-Key", "c2hvcnQ=") }, http.StatusBadRequest},
+		{"cross origin", func(r *http.Request) { r.Header.Set("Origin", "https://evil.example") }, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := request(tt.modify); status != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, status)
+			}
+		})
+	}
+}
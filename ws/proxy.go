@@ -0,0 +1,211 @@
+package ws
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// returns the proxy set in HTTPS_PROXY, HTTP_PROXY and NO_PROXY env variables
+//
+// wss urls use HTTPS_PROXY and ws urls use HTTP_PROXY
+func ProxyFromEnvironment(u *url.URL) (*url.URL, error) {
+	return http.ProxyFromEnvironment(&http.Request{URL: httpUrl(u)})
+}
+
+// returns a proxy function that always uses the given proxy
+func ProxyURL(proxy *url.URL) func(*url.URL) (*url.URL, error) {
+	return func(*url.URL) (*url.URL, error) {
+		return proxy, nil
+	}
+}
+
+// connects to the proxy and opens a tunnel to addr
+func (d *Dialer) dialProxy(ctx context.Context, proxy *url.URL, addr string) (net.Conn, error) {
+	conn, err := d.netDial(ctx, "tcp", hostPort(proxy))
+	if err != nil {
+		return nil, fmt.Errorf("error in proxy dial: %w", err)
+	}
+	err = withContext(ctx, conn, func() error {
+		switch proxy.Scheme {
+		case "http":
+			return httpConnect(conn, proxy, addr)
+		case "https":
+			// custom roots and client certificates apply to the proxy too
+			cfg := &tls.Config{}
+			if d.TLSConfig != nil {
+				cfg = d.TLSConfig.Clone()
+			}
+			cfg.ServerName = proxy.Hostname()
+			tlsConn := tls.Client(conn, cfg)
+			if err := tlsConn.Handshake(); err != nil {
+				return err
+			}
+			conn = tlsConn
+			return httpConnect(conn, proxy, addr)
+		case "socks5", "socks5h":
+			return socks5Connect(conn, proxy, addr)
+		default:
+			return fmt.Errorf("unsupported proxy scheme: %s", proxy.Scheme)
+		}
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy error: %w", err)
+	}
+	return conn, nil
+}
+
+// opens a tunnel with an http CONNECT request
+func httpConnect(conn net.Conn, proxy *url.URL, addr string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	// read byte by byte, nothing after the response may be consumed
+	// the body is never read, the tunnel owns the rest of the stream
+	resp, err := http.ReadResponse(bufio.NewReaderSize(oneByteReader{conn}, 16), req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("CONNECT %s: %s", addr, resp.Status)
+	}
+	return nil
+}
+
+// reader that never reads past what the caller asks for
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (o oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return o.r.Read(p[:1])
+}
+
+// socks5 constants (RFC 1928, RFC 1929)
+const (
+	socks5Version      = 0x05
+	socks5NoAuth       = 0x00
+	socks5UserPassAuth = 0x02
+	socks5CmdConnect   = 0x01
+	socks5AddrIPv4     = 0x01
+	socks5AddrDomain   = 0x03
+	socks5AddrIPv6     = 0x04
+)
+
+// opens a tunnel through a socks5 proxy
+//
+// the host name is resolved by the proxy
+func socks5Connect(conn net.Conn, proxy *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return err
+	}
+	if len(host) > 255 {
+		return errors.New("socks5: host name too long")
+	}
+
+	// greeting with the supported auth methods
+	methods := []byte{socks5NoAuth}
+	if proxy.User != nil {
+		methods = append(methods, socks5UserPassAuth)
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected version %d", reply[0])
+	}
+	switch reply[1] {
+	case socks5NoAuth:
+	case socks5UserPassAuth:
+		if proxy.User == nil {
+			return errors.New("socks5: proxy requires authentication")
+		}
+		user := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		if len(user) > 255 || len(password) > 255 {
+			return errors.New("socks5: credentials too long")
+		}
+		auth := []byte{0x01, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return errors.New("socks5: authentication failed")
+		}
+	default:
+		return errors.New("socks5: no acceptable authentication method")
+	}
+
+	// connect request
+	req := []byte{socks5Version, socks5CmdConnect, 0x00, socks5AddrDomain, byte(len(host))}
+	req = append(req, host...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0x00 {
+		return fmt.Errorf("socks5: connect failed with code %d", head[1])
+	}
+	// skip the bound address
+	var skip int
+	switch head[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return err
+		}
+		skip = int(l[0])
+	default:
+		return fmt.Errorf("socks5: unknown address type %d", head[3])
+	}
+	_, err = io.CopyN(io.Discard, conn, int64(skip+2))
+	return err
+}
@@ -0,0 +1,378 @@
+package ws
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// header of a frame, the payload is left in the connection reader
+type frameHeader struct {
+	fin    bool
+	rsv1   bool
+	opcode byte
+	length int64
+	mask   []byte
+}
+
+// reads the next frame header from the connection and validates it
+func (c *Conn) readFrameHeader() (frameHeader, error) {
+	// read first 2 bytes to determin message type and length
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.br, header); err != nil {
+		return frameHeader{}, err
+	}
+	h := frameHeader{
+		fin:    (header[0] & 0b10000000) != 0,
+		rsv1:   (header[0] & 0b01000000) != 0,
+		opcode: header[0] & 0b00001111,
+	}
+	if (header[0] & 0b00110000) != 0 {
+		return h, protocolError("reserved bits set")
+	}
+	if h.rsv1 && c.deflate == nil {
+		return h, protocolError("received compressed frame without negotiated compression")
+	}
+	switch h.opcode {
+	case ContinuationOpcode, TextOpcode, BinaryOpcode, CloseOpcode, PingOpcode, PongOpcode:
+	default:
+		return h, protocolError(fmt.Sprintf("unknown opcode: %d", h.opcode))
+	}
+
+	// client frames must be masked and server frames must not
+	masked := (header[1] & 0b10000000) != 0
+	if masked != c.isServer {
+		if c.isServer {
+			return h, protocolError("received unmasked frame")
+		}
+		return h, protocolError("received masked frame")
+	}
+
+	payloadLen := uint64(header[1] & 0b01111111)
+	// determing if payload is extended or it's full.
+	if payloadLen == 126 {
+		// payload length is extended to the next 2 byets
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(c.br, extended); err != nil {
+			return h, err
+		}
+		payloadLen = uint64(binary.BigEndian.Uint16(extended))
+	} else if payloadLen == 127 {
+		// payload length is extended to the next 8 byets
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(c.br, extended); err != nil {
+			return h, err
+		}
+		payloadLen = binary.BigEndian.Uint64(extended)
+		if payloadLen>>63 != 0 {
+			return h, protocolError("invalid payload length")
+		}
+	}
+
+	if h.opcode >= CloseOpcode {
+		// control frames can't be fragmented or compressed
+		if !h.fin || payloadLen > 125 || h.rsv1 {
+			return h, protocolError("invalid control frame")
+		}
+	}
+	// never trust a length bigger than the limit, it comes from the peer
+	if payloadLen > uint64(c.maxFrameSize()) {
+		return h, &CloseError{Code: CloseMessageTooBig, Text: "frame too big"}
+	}
+	h.length = int64(payloadLen)
+
+	if masked {
+		h.mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.br, h.mask); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// reads frames until the next data frame, control frames are handled on the way
+func (c *Conn) nextDataFrame() (frameHeader, error) {
+	for {
+		h, err := c.readFrameHeader()
+		if err != nil {
+			return h, err
+		}
+		if h.opcode < CloseOpcode {
+			return h, nil
+		}
+
+		payload := make([]byte, h.length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return h, err
+		}
+		maskBytes(h.mask, 0, payload)
+
+		switch h.opcode {
+		case PingOpcode:
+			// reply with the same payload
+			c.writeControl(PongOpcode, payload)
+			if c.OnPing != nil {
+				c.OnPing()
+			}
+		case PongOpcode:
+			if c.OnPong != nil {
+				c.OnPong()
+			}
+		case CloseOpcode:
+			return h, c.handleClose(payload)
+		}
+	}
+}
+
+// returns the type of the next message (TextOpcode or BinaryOpcode) and a reader over its payload
+//
+// the reader is valid until the next call, unread data of the previous message is discarded.
+// control frames are handled while reading. must not be used together with Run
+func (c *Conn) NextReader() (int, io.Reader, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+	// discard the rest of the previous message
+	if c.body != nil {
+		if _, err := io.Copy(io.Discard, c.body); err != nil {
+			return 0, nil, err
+		}
+		c.body = nil
+	}
+
+	h, err := c.nextDataFrame()
+	if err != nil {
+		return 0, nil, c.readError(err)
+	}
+	if h.opcode == ContinuationOpcode {
+		return 0, nil, c.readError(protocolError("unexpected continuation frame"))
+	}
+
+	frames := &frameReader{c: c}
+	if err := frames.setFrame(h); err != nil {
+		return 0, nil, c.readError(err)
+	}
+	body := &messageBody{
+		c:      c,
+		frames: frames,
+		src:    frames,
+		text:   h.opcode == TextOpcode,
+	}
+	// rsv1 is only set on the first frame of a compressed message
+	if h.rsv1 {
+		body.src, err = c.deflate.newReader(frames)
+		if err != nil {
+			return 0, nil, c.readError(err)
+		}
+	}
+	c.body = body
+	return int(h.opcode), body, nil
+}
+
+// stores the error that ends reading and closes the connection
+func (c *Conn) readError(err error) error {
+	if c.readErr != nil {
+		return c.readErr
+	}
+	err = c.fail(err)
+	c.readErr = err
+	// the client may reconnect from OnDisconnect, c is not touched after finish
+	c.finish()
+	return err
+}
+
+// reads the raw payload of a message across its frames
+type frameReader struct {
+	c *Conn
+	// payload left in the current frame
+	remaining int64
+	mask      []byte
+	maskPos   int
+	// the current frame is the last of the message
+	fin bool
+	// raw bytes of the message so far
+	total int64
+}
+
+func (r *frameReader) setFrame(h frameHeader) error {
+	if r.total+h.length > r.c.maxMessageSize() {
+		return &CloseError{Code: CloseMessageTooBig, Text: "message too big"}
+	}
+	r.total += h.length
+	r.remaining = h.length
+	r.mask = h.mask
+	r.maskPos = 0
+	r.fin = h.fin
+	return nil
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	for r.remaining == 0 {
+		if r.fin {
+			return 0, io.EOF
+		}
+		h, err := r.c.nextDataFrame()
+		if err != nil {
+			return 0, err
+		}
+		if h.opcode != ContinuationOpcode {
+			return 0, protocolError("expected continuation frame")
+		}
+		if h.rsv1 {
+			return 0, protocolError("rsv1 set on continuation frame")
+		}
+		if err := r.setFrame(h); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.c.br.Read(p)
+	r.maskPos = maskBytes(r.mask, r.maskPos, p[:n])
+	r.remaining -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// message returned by NextReader, enforces the size limit and utf-8 text
+type messageBody struct {
+	c      *Conn
+	frames *frameReader
+	// frames or the inflater reading from them
+	src  io.Reader
+	text bool
+	utf8 utf8Validator
+	// bytes returned so far
+	n   int64
+	eof bool
+}
+
+func (b *messageBody) Read(p []byte) (int, error) {
+	if b.c.readErr != nil {
+		return 0, b.c.readErr
+	}
+	if b.eof {
+		return 0, io.EOF
+	}
+	n, err := b.src.Read(p)
+	b.n += int64(n)
+	if b.n > b.c.maxMessageSize() {
+		return 0, b.c.readError(&CloseError{Code: CloseMessageTooBig, Text: "message too big"})
+	}
+	if b.text && !b.utf8.valid(p[:n]) {
+		return 0, b.c.readError(&CloseError{Code: CloseInvalidFramePayloadData, Text: "invalid utf-8 text"})
+	}
+	if err == io.EOF {
+		// the inflater may stop before the end of the frames
+		if _, err := io.Copy(io.Discard, b.frames); err != nil {
+			return 0, b.c.readError(err)
+		}
+		if b.text && !b.utf8.complete() {
+			return 0, b.c.readError(&CloseError{Code: CloseInvalidFramePayloadData, Text: "invalid utf-8 text"})
+		}
+		b.eof = true
+		return n, io.EOF
+	}
+	if err != nil {
+		var closeErr *CloseError
+		if src := b.src; src != b.frames && !errors.As(err, &closeErr) {
+			// corrupted compressed data
+			err = &CloseError{Code: CloseInvalidFramePayloadData, Text: err.Error()}
+		}
+		return n, b.c.readError(err)
+	}
+	return n, nil
+}
+
+// validates utf-8 text received in pieces
+type utf8Validator struct {
+	// start of a rune split across reads
+	pending []byte
+}
+
+func (v *utf8Validator) valid(p []byte) bool {
+	if len(v.pending) > 0 {
+		p = append(v.pending, p...)
+		v.pending = nil
+	}
+	// a rune may continue in the next read, keep its first bytes
+	end := len(p)
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	if !utf8.Valid(p[:end]) {
+		return false
+	}
+	v.pending = append(v.pending, p[end:]...)
+	return true
+}
+
+// reports whether the text ended on a rune boundary
+func (v *utf8Validator) complete() bool {
+	return len(v.pending) == 0
+}
+
+// masks or unmasks p in place starting at pos of the mask, returns the next position
+func maskBytes(mask []byte, pos int, p []byte) int {
+	if mask == nil {
+		return pos
+	}
+	for i := range p {
+		p[i] ^= mask[pos%4]
+		pos++
+	}
+	return pos % 4
+}
+
+// reads messages and calls the callbacks until the connection is closed
+//
+// Client.Connect runs it in its own goroutine, server connections must call it
+// after setting the callbacks
+func (c *Conn) Run() {
+	done := c.done
+	err := c.readMessages()
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) && closeErr.Code != CloseNormalClosure && closeErr.Code != CloseNoStatusReceived {
+		println(closeErr.Error())
+	}
+	select {
+	case <-done:
+		// already finished, c may belong to a new connection by now
+	default:
+		c.finish()
+	}
+}
+
+func (c *Conn) readMessages() error {
+	for {
+		messageType, r, err := c.NextReader()
+		if err != nil {
+			return err
+		}
+		// the size of the message is bounded by MaxMessageSize
+		message, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		switch messageType {
+		case TextOpcode:
+			if c.OnTextMessage != nil {
+				c.OnTextMessage(string(message))
+			}
+		case BinaryOpcode:
+			if c.OnBinaryMessage != nil {
+				c.OnBinaryMessage(message)
+			}
+		}
+	}
+}
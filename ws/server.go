@@ -0,0 +1,153 @@
+package ws
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Upgrader turns http requests into server side websocket connections
+//
+// it can be used as an http.Handler when OnConnect is set
+type Upgrader struct {
+	// subprotocols supported by the server in order of preference
+	Subprotocols []string
+	// returns true if the request origin is allowed, nil allows same host origins only
+	CheckOrigin func(r *http.Request) bool
+	// accept permessage-deflate offered by clients, nil disables compression
+	Compression *CompressionOptions
+	// extra headers sent with the handshake response
+	Header http.Header
+	// called with every new connection before its messages are read by ServeHTTP
+	OnConnect func(c *Conn)
+}
+
+// upgrades the request and reads messages until the connection is closed
+func (u *Upgrader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, err := u.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	if u.OnConnect != nil {
+		u.OnConnect(c)
+	}
+	c.Run()
+}
+
+// performs the server handshake and takes over the connection
+//
+// on failure an http error is sent to the client and the error is returned.
+// the caller sets the callbacks of the returned connection and then calls Run
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet {
+		return nil, u.reject(w, http.StatusMethodNotAllowed, "websocket: method must be GET")
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") {
+		return nil, u.reject(w, http.StatusBadRequest, "websocket: connection header must contain upgrade")
+	}
+	if !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return nil, u.reject(w, http.StatusBadRequest, "websocket: upgrade header must be websocket")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, u.reject(w, http.StatusUpgradeRequired, "websocket: unsupported version")
+	}
+	key := strings.TrimSpace(r.Header.Get("Sec-WebSocket-Key"))
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, u.reject(w, http.StatusBadRequest, "websocket: invalid Sec-WebSocket-Key")
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return nil, u.reject(w, http.StatusForbidden, "websocket: origin not allowed")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, u.reject(w, http.StatusInternalServerError, "websocket: response does not support hijacking")
+	}
+
+	protocol := u.selectSubprotocol(r)
+	var deflate *deflateState
+	var extensions string
+	if u.Compression != nil {
+		deflate, extensions = acceptDeflateExtension(r.Header.Values("Sec-WebSocket-Extensions"), u.Compression)
+	}
+
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// handshake response
+	var resp strings.Builder
+	resp.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + computeAcceptKey(key) + "\r\n")
+	if protocol != "" {
+		resp.WriteString("Sec-WebSocket-Protocol: " + protocol + "\r\n")
+	}
+	if extensions != "" {
+		resp.WriteString("Sec-WebSocket-Extensions: " + extensions + "\r\n")
+	}
+	for k, values := range u.Header {
+		for _, v := range values {
+			fmt.Fprintf(&resp, "%s: %s\r\n", k, v)
+		}
+	}
+	resp.WriteString("\r\n")
+	if _, err := conn.Write([]byte(resp.String())); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &Conn{
+		subprotocol: protocol,
+		deflate:     deflate,
+	}
+	// frames sent by the client right after the request may already be buffered
+	c.init(conn, brw.Reader, true)
+	return c, nil
+}
+
+// writes an http error response and returns it as error
+func (u *Upgrader) reject(w http.ResponseWriter, status int, reason string) error {
+	http.Error(w, reason, status)
+	return errors.New(reason)
+}
+
+// returns the first subprotocol of the server also offered by the client
+func (u *Upgrader) selectSubprotocol(r *http.Request) string {
+	var offered []string
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			offered = append(offered, strings.TrimSpace(p))
+		}
+	}
+	for _, p := range u.Subprotocols {
+		if slices.Contains(offered, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// allows requests without Origin or with an Origin matching the Host header
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"errors"
+	"io"
+)
+
+// returns a writer for a new message of the given type (TextOpcode or BinaryOpcode)
+//
+// every Write is sent right away as a fragment, Close sends the final frame.
+// other messages wait until the writer is closed, control frames don't
+func (c *Conn) NextWriter(messageType int) (io.WriteCloser, error) {
+	if messageType != TextOpcode && messageType != BinaryOpcode {
+		return nil, errors.New("invalid message type")
+	}
+	if c.conn == nil {
+		return nil, errors.New("not connected")
+	}
+	c.mmu.Lock()
+	w := &messageWriter{
+		c:        c,
+		opcode:   byte(messageType),
+		compress: c.deflate != nil,
+	}
+	if w.compress {
+		if err := c.deflate.resetWriter(); err != nil {
+			c.mmu.Unlock()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// writes a message as a sequence of fragments
+type messageWriter struct {
+	c *Conn
+	// opcode of the next frame, continuation after the first one
+	opcode   byte
+	compress bool
+	closed   bool
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write on closed message writer")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	out := p
+	if w.compress {
+		var err error
+		out, err = w.c.deflate.write(p)
+		if err != nil {
+			return 0, err
+		}
+		if len(out) == 0 {
+			// the compressor is still buffering
+			return len(p), nil
+		}
+	}
+	if err := w.writeFrame(false, out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// sends the final frame of the message
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return errors.New("message writer already closed")
+	}
+	w.closed = true
+	defer w.c.mmu.Unlock()
+	var last []byte
+	if w.compress {
+		var err error
+		last, err = w.c.deflate.flush()
+		if err != nil {
+			return err
+		}
+	}
+	return w.writeFrame(true, last)
+}
+
+func (w *messageWriter) writeFrame(fin bool, p []byte) error {
+	w.c.wmu.Lock()
+	defer w.c.wmu.Unlock()
+	if w.c.closeSent {
+		return errors.New("connection is closing")
+	}
+	// rsv1 marks the first frame of a compressed message
+	rsv1 := w.compress && w.opcode != ContinuationOpcode
+	err := w.c.writeFrame(fin, rsv1, w.opcode, p)
+	w.opcode = ContinuationOpcode
+	return err
+}